@@ -27,10 +27,44 @@ var buildTime = "2016-03-15"
 // Constant and data type/structure definitions
 
 type Check struct {
-	Filei     *os.File `goptions:"-i, --input, obligatory, description='The web test script to check', rdonly"`
+	Filei     []string `goptions:"-i, --input, obligatory, description='The web test scripts to check, files, directories or globs,\n\t\t\t\tcan be given more than once, - for stdin'"`
 	Checks    string   `goptions:"-c, --check, description='Check regexp'"`
 	ThinkTime int      `goptions:"--thinktime, description='ThinkTime canonical value (default: 0)'"`
 	Timeout   int      `goptions:"--timeout, description='Timeout canonical value'"`
+	Rules     *os.File `goptions:"-r, --rules, description='Lint rules configuration, a YAML file to enable/disable rules\n\t\t\t\tand set their severity and parameters', rdonly"`
+	Fileo     string   `goptions:"-o, --output, description='Write the findings to this file as well, in the --format format,\n\t\t\t\t- for stdout, then the findings are shown on stderr'"`
+	Format    string   `goptions:"-f, --format, description='The findings output format, json, junit or sarif (default: json)'"`
+	FailOn    string   `goptions:"--fail-on, description='Exit with status 3 when there are findings of at least\n\t\t\t\tthis severity, info, warning or error (default: info)'"`
+	KeepGoing bool     `goptions:"-k, --keep-going, description='Report all the problems in the web test script, not just the first'"`
+	Jobs      int      `goptions:"-j, --jobs, description='The number of scripts to check in parallel (default: the CPU count)'"`
+}
+
+type Dump struct {
+	Filei     []string `goptions:"-i, --input, obligatory, description='The web test scripts to dump, files, directories or globs,\n\t\t\t\tcan be given more than once, - for stdin'"`
+	Fileo     string   `goptions:"-o, --output, description='The web test script dump output, for a single input only, - for stdout\n\t\t\t\t(default: .webtext file next to each input, stdout for stdin)'"`
+	Asis      bool     `goptions:"--asis, description='Output StringBody as-is, no XML decoding'"`
+	Cnr       bool     `goptions:"-c, --cnr, description='Comment number removal, for easy comparison'"`
+	Tsr       bool     `goptions:"-t, --tsr, description='Time string removal, for easy comparison'"`
+	Raw       bool     `goptions:"-r, --raw, description='Raw mode, for fresh recordings and easy comparison\n\t\t\t\tWill enable --cnr as well and \n\t\t\t\tapply rules from the .rawrule file if exist'"`
+	Rawrule   string   `goptions:"--rawrule, description='The .rawrule file to use in raw mode\n\t\t\t\t(default: .rawrule file next to each input,\n\t\t\t\tif exist, none for stdin)'"`
+	Format    string   `goptions:"-f, --format, description='Output format, text, json or yaml (default: text)'"`
+	KeepGoing bool     `goptions:"-k, --keep-going, description='Report all the problems in the web test script, not just the first'"`
+	Jobs      int      `goptions:"-j, --jobs, description='The number of scripts to dump in parallel (default: the CPU count)'"`
+}
+
+type Fmt struct {
+	Filei []string `goptions:"-i, --input, obligatory, description='The web test scripts to format in place, files, directories or globs,\n\t\t\t\tcan be given more than once, - for stdin to stdout'"`
+	Check bool     `goptions:"--check, description='Only list the scripts not canonically formatted, and fail if any'"`
+	Guids bool     `goptions:"-g, --guids, description='Make the request Guids and the condition and loop ids deterministic'"`
+	Eol   string   `goptions:"--eol, description='The line endings, crlf or lf (default: crlf, as Visual Studio writes)'"`
+	Jobs  int      `goptions:"-j, --jobs, description='The number of scripts to format in parallel (default: the CPU count)'"`
+}
+
+type Fix struct {
+	Filei     *os.File `goptions:"-i, --input, obligatory, description='The web test script to fix in place', rdonly"`
+	ThinkTime int      `goptions:"--thinktime, description='ThinkTime canonical value (default: 0)'"`
+	Timeout   int      `goptions:"--timeout, description='Timeout canonical value, lower ones are raised to it (default: 270)'"`
+	DryRun    bool     `goptions:"-n, --dry-run, description='Show the changes as a diff, without writing them'"`
 }
 
 type Options struct {
@@ -42,14 +76,61 @@ type Options struct {
 
 	Check `goptions:"check"` // Embedding!
 
-	Dump struct {
-		Filei *os.File `goptions:"-i, --input, obligatory, description='The web test script to dump', rdonly"`
-		Fileo *os.File `goptions:"-o, --output, description='The web test script dump output (default: .webtext file of input)', wronly"`
-		Asis  bool     `goptions:"--asis, description='Output StringBody as-is, no XML decoding'"`
-		Cnr   bool     `goptions:"-c, --cnr, description='Comment number removal, for easy comparison'"`
-		Tsr   bool     `goptions:"-t, --tsr, description='Time string removal, for easy comparison'"`
-		Raw   bool     `goptions:"-r, --raw, description='Raw mode, for fresh recordings and easy comparison\n\t\t\t\tWill enable --cnr as well and \n\t\t\t\tapply rules from the .rawrule file if exist'"`
-	} `goptions:"dump"`
+	Dump `goptions:"dump"`
+
+	Build struct {
+		Filei *os.File `goptions:"-i, --input, obligatory, description='The web test text (.webtext) to build from', rdonly"`
+		Fileo *os.File `goptions:"-o, --output, description='The web test script build output (default: .webtest file of input)', wronly"`
+		Base  *os.File `goptions:"-b, --base, description='The web test script to take WebTest settings, rule class names\n\t\t\t\tand request Guids from', rdonly"`
+	} `goptions:"build"`
+
+	Diff struct {
+		Filea *os.File `goptions:"-a, --old, obligatory, description='The old web test script to compare', rdonly"`
+		Fileb *os.File `goptions:"-b, --new, obligatory, description='The new web test script to compare', rdonly"`
+		Exact bool     `goptions:"-e, --exact, description='Compare as-is, without the raw mode normalizations\n\t\t\t\tand time string removal'"`
+	} `goptions:"diff"`
+
+	Fix `goptions:"fix"`
+
+	Fmt `goptions:"fmt"`
+
+	Param struct {
+		Filei  *os.File `goptions:"-i, --input, obligatory, description='The web test script to parameterize', rdonly"`
+		Fileo  *os.File `goptions:"-o, --output, description='The parameterized web test script (default: .param.webtest file of input)', wronly"`
+		Prefix string   `goptions:"-p, --prefix, description='The context parameter name prefix (default: WebServer)'"`
+	} `goptions:"param"`
+
+	Correlate struct {
+		Filei   *os.File `goptions:"-i, --input, obligatory, description='The web test script to find correlation candidates in', rdonly"`
+		Min     int      `goptions:"-m, --min, description='The minimum number of requests a token is used in (default: 2)'"`
+		Rawrule *os.File `goptions:"-r, --rawrule, description='Write the placeholder replacements of the candidates to this .rawrule file', wronly"`
+	} `goptions:"correlate"`
+
+	Rawrule struct {
+		Filei *os.File `goptions:"-i, --input, description='The .rawrule file to validate', rdonly"`
+
+		goptions.Verbs
+		Test struct {
+			Filei *os.File `goptions:"-i, --input, obligatory, description='The .rawrule file to validate and check the examples of', rdonly"`
+		} `goptions:"test"`
+	} `goptions:"rawrule"`
+
+	Run struct {
+		Filei         []string `goptions:"-i, --input, obligatory, description='The web test scripts to run, files, directories or globs,\n\t\t\t\tcan be given more than once, - for stdin'"`
+		Params        []string `goptions:"-p, --param, description='Set the context parameter, name=value, over the web test one,\n\t\t\t\tcan be given more than once'"`
+		NoThinkTime   bool     `goptions:"-n, --no-think-time, description='Do not wait the ThinkTime of the requests'"`
+		MaxIterations int      `goptions:"--max-iterations, description='Fail a loop without MaxIterations after this many iterations (default: 1000)'"`
+		Timeout       int      `goptions:"--timeout, description='The Timeout in seconds of the requests without one (default: 300)'"`
+	} `goptions:"run"`
+
+	Textconv struct {
+		Raw bool `goptions:"-r, --raw, description='Raw mode, the way dump --raw does'"`
+		goptions.Remainder
+	} `goptions:"textconv"`
+
+	Merge struct {
+		goptions.Remainder
+	} `goptions:"merge"`
 }
 
 ////////////////////////////////////////////////////////////////////////////
@@ -61,13 +142,27 @@ var options = Options{ // Default values goes here
 		ThinkTime: 0,
 		Timeout:   270,
 	},
+	Fix: Fix{
+		ThinkTime: 0,
+		Timeout:   270,
+	},
 }
 
 type Command func() error
 
 var commands = map[goptions.Verbs]Command{
-	"check": checkCmd,
-	"dump":  dumpCmd,
+	"check":     checkCmd,
+	"dump":      dumpCmd,
+	"build":     buildCmd,
+	"diff":      diffCmd,
+	"fix":       fixCmd,
+	"fmt":       fmtCmd,
+	"param":     paramCmd,
+	"correlate": correlateCmd,
+	"rawrule":   rawruleCmd,
+	"run":       runCmd,
+	"textconv":  textconvCmd,
+	"merge":     mergeCmd,
 }
 
 var (
@@ -91,6 +186,9 @@ func main() {
 
 	if cmd, found := commands[options.Verbs]; found {
 		err := cmd()
+		if _, ok := err.(FindingsError); ok {
+			os.Exit(exitFindings)
+		}
 		if err != nil {
 			if !options.Quiet {
 				fmt.Printf("%s error: %v", progname, err)
@@ -99,3 +197,12 @@ func main() {
 		}
 	}
 }
+
+func debug(input string, threshold int) {
+	if !(VERBOSITY >= threshold) {
+		return
+	}
+	print("] ")
+	print(input)
+	print("\n")
+}
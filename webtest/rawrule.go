@@ -0,0 +1,467 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: rawrule.go
+// Purpose: raw-rule handling for wts dump
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+import (
+	"github.com/AntonioSun/shaper"
+	"gopkg.in/yaml.v3"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+/*
+
+The .rawrule file is a YAML file like this:
+
+  include: ../company.rawrule
+  replace:
+    '<(RoleId)>\w+</(RoleId)>': '--'
+  rules:
+    - regexp: '[?&]_=\d+'
+      replace: ''
+      scope: [url, query]
+    - regexp: '\[#\d+\] *'
+      scope: [comment]
+      enabled: false
+    - regexp: '<(Ticks)>\d+</Ticks>'
+      replace: '<$1>-</$1>'
+      examples:
+        - input: '<Ticks>636021</Ticks>'
+          output: '<Ticks>-</Ticks>'
+  extract:
+    - name: SessionTicket
+      regexp: '<SessionTicket>(.*?)</SessionTicket>'
+      scope: [body]
+      placeholder: '{{Param_SessionId}}'
+  summarize:
+    '.*<ReadableRequestName>|</ReadableRequestName>.*': ''
+
+The included files (relative to the including one) come first, then the
+rules of the file itself, applied in the order they are written. The
+replace ones are rules that apply to the POST StringBody, which is also
+the default scope of the rules. A rule, e.g., one from a shared included
+file, can be disabled with enabled: false. The examples of a rule are
+checked by the rawrule test verb, against all the rules of each of
+its scopes, the same way they are applied in the dump.
+
+The extract rules capture the first submatch of their regexp, the first
+time it is found within the given scopes (url, body, query, form or
+header), then
+replace the captured value with the placeholder everywhere afterward. The
+summarize rules turn the POST StringBody into the service label shown
+after the Url, in turn.
+
+Without any extract or summarize section, the DF ones below are used.
+
+YAML v3 is used here for the line numbers in the validation errors.
+
+*/
+type RawRule struct {
+	Include   []string     `yaml:"include,omitempty"`
+	Rules     []RawReplace `yaml:"rules,omitempty"`
+	Extract   []RawExtract `yaml:"extract,omitempty"`
+	Summarize []RawReplace `yaml:"-"`
+}
+
+// RawReplace is a regexp replacement rule
+type RawReplace struct {
+	Regexp  string   `yaml:"regexp"`
+	Replace string   `yaml:"replace"`
+	Scope   []string `yaml:"scope,omitempty,flow"`
+	Enabled *bool    `yaml:"enabled,omitempty"`
+
+	Examples []RawExample `yaml:"examples,omitempty"`
+
+	pos string // file:line, for the errors
+}
+
+// RawExample is an input and its expected output, of all the rules of the
+// scope for a replace rule, or the captured value for an extract rule
+type RawExample struct {
+	Input  string `yaml:"input"`
+	Output string `yaml:"output"`
+}
+
+// RawExtract declares a dynamic value to capture and substitute
+type RawExtract struct {
+	Name        string
+	Regexp      string
+	Scope       []string `yaml:",flow"`
+	Placeholder string
+	Examples    []RawExample `yaml:",omitempty"`
+
+	pos string
+}
+
+// rawExtractor is a RawExtract in action
+type rawExtractor struct {
+	RawExtract
+	rexp  *regexp.Regexp
+	scope map[string]bool
+	value string // the captured value, once found
+}
+
+// rawScopes are the scopes of the extract rules. The replace rules can
+// apply to the comments as well
+var rawScopes = map[string]bool{
+	"url": true, "body": true, "query": true, "form": true, "header": true}
+
+// rawExtractDefault are the DF session ticket and client browser id
+var rawExtractDefault = []RawExtract{
+	{Name: "SessionTicket", Regexp: `<SessionTicket>(.*?)</SessionTicket>`,
+		Scope: []string{"body"}, Placeholder: "{{Param_SessionId}}"},
+	{Name: "ClientBrowserId", Regexp: `force/u/(.*?)/`,
+		Scope: []string{"url"}, Placeholder: "{{Param_ClientBrowserId}}"},
+}
+
+// rawSummarizeDefault labels the DF core service requests
+var rawSummarizeDefault = []RawReplace{
+	{Regexp: `.*(Get)</ReadableRequestName><RequestName>(.*?)</RequestName>.*&lt;MethodName&gt;(.*?)&lt;/MethodName&gt;.*`,
+		Replace: "$1.$2.$3"},
+	{Regexp: `.*<ReadableCorrelator>|</ReadableCorrelator>.*`, Replace: ""},
+	{Regexp: `.*<ReadableRequestName>|</ReadableRequestName>.*`, Replace: ""},
+}
+
+// rawState is the .rawrule rules in action, for one web test script
+type rawState struct {
+	rules      map[string]*shaper.Shaper // the replace rules, by scope
+	extractors []*rawExtractor
+	// found replaces the extracted values with their placeholders
+	found *shaper.Shaper
+	// summarize makes the service label out of the POST StringBody
+	summarize *shaper.Shaper
+	file      string // the .rawrule file read, none if empty
+}
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// rawRuleRead reads the .rawrule file and its included ones, then
+// validates and applies all their rules. An optional file that does not
+// exist, or none given, is not read. The state tells the file when it is
+func rawRuleRead(filename string, optional bool) (*rawState, error) {
+	var rawRule RawRule
+	read := len(filename) != 0
+	if _, err := os.Stat(filename); optional && os.IsNotExist(err) {
+		read = false
+	}
+	if read {
+		if err := rawRuleLoad(filename, &rawRule, map[string]bool{}); err != nil {
+			return nil, err
+		}
+	}
+	rs, err := rawRuleApply(&rawRule)
+	if err != nil {
+		return nil, err
+	}
+	if read {
+		rs.file = filename
+	}
+	return rs, nil
+}
+
+// rawRuleLoad adds the rules of the file, after those of its included
+// files, to rawRule. The including are the files being loaded, which
+// include it, so a file can be included by several others, but not by
+// itself
+func rawRuleLoad(filename string, rawRule *RawRule, including map[string]bool) error {
+	abs, _ := filepath.Abs(filename)
+	if including[abs] {
+		return fmt.Errorf("%s: included by itself", filename)
+	}
+	including[abs] = true
+	defer delete(including, abs)
+
+	source, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	//debug(string(source), 1)
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(source, &doc); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: not a mapping of rule sections",
+			filename, root.Line)
+	}
+
+	pos := func(n *yaml.Node) string {
+		return fmt.Sprintf("%s:%d", filename, n.Line)
+	}
+	// the mapping form of replace and summarize keeps the order of the rules
+	pairs := func(n *yaml.Node, scope []string) ([]RawReplace, error) {
+		if n.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s: a mapping of regexp: replacement expected",
+				pos(n))
+		}
+		var rules []RawReplace
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			rules = append(rules, RawReplace{Regexp: n.Content[i].Value,
+				Replace: n.Content[i+1].Value, Scope: scope,
+				pos: pos(n.Content[i])})
+		}
+		return rules, nil
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "include":
+			var includes []string
+			if value.Kind == yaml.ScalarNode {
+				includes = []string{value.Value}
+			} else if err := value.Decode(&includes); err != nil {
+				return fmt.Errorf("%s: %v", pos(value), err)
+			}
+			for _, inc := range includes {
+				if !filepath.IsAbs(inc) {
+					inc = filepath.Join(filepath.Dir(filename), inc)
+				}
+				if err := rawRuleLoad(inc, rawRule, including); err != nil {
+					return fmt.Errorf("%s: include %v", pos(value), err)
+				}
+			}
+		case "replace":
+			rules, err := pairs(value, []string{"body"})
+			if err != nil {
+				return err
+			}
+			rawRule.Rules = append(rawRule.Rules, rules...)
+		case "rules":
+			var rules []RawReplace
+			if err := value.Decode(&rules); err != nil {
+				return fmt.Errorf("%s: %v", pos(value), err)
+			}
+			for j := range rules {
+				rules[j].pos = pos(value.Content[j])
+			}
+			rawRule.Rules = append(rawRule.Rules, rules...)
+		case "extract":
+			var extract []RawExtract
+			if err := value.Decode(&extract); err != nil {
+				return fmt.Errorf("%s: %v", pos(value), err)
+			}
+			for j := range extract {
+				extract[j].pos = pos(value.Content[j])
+			}
+			if rawRule.Extract == nil {
+				rawRule.Extract = []RawExtract{}
+			}
+			rawRule.Extract = append(rawRule.Extract, extract...)
+		case "summarize":
+			rules, err := pairs(value, nil)
+			if err != nil {
+				return err
+			}
+			if rawRule.Summarize == nil {
+				rawRule.Summarize = []RawReplace{}
+			}
+			rawRule.Summarize = append(rawRule.Summarize, rules...)
+		default:
+			return fmt.Errorf("%s: unknown section '%s'", pos(key), key.Value)
+		}
+	}
+	return nil
+}
+
+// rawRuleApply validates all the rules, reporting each bad one by its
+// position, and puts the good ones in action
+func rawRuleApply(rawRule *RawRule) (*rawState, error) {
+	if rawRule.Extract == nil {
+		rawRule.Extract = rawExtractDefault
+	}
+	if rawRule.Summarize == nil {
+		rawRule.Summarize = rawSummarizeDefault
+	}
+
+	var errs []string
+	bad := func(pos, format string, a ...interface{}) {
+		if len(pos) == 0 {
+			pos = "(default)"
+		}
+		errs = append(errs, pos+": "+fmt.Sprintf(format, a...))
+	}
+
+	rs := &rawState{rules: map[string]*shaper.Shaper{},
+		found: shaper.NewFilter(), summarize: shaper.NewFilter()}
+	for _, r := range rawRule.Rules {
+		if r.Enabled != nil && !*r.Enabled {
+			continue
+		}
+		if _, err := regexp.Compile(r.Regexp); err != nil {
+			bad(r.pos, "rule: %v", err)
+			continue
+		}
+		scope := r.Scope
+		if len(scope) == 0 {
+			scope = []string{"body"}
+		}
+		for _, s := range scope {
+			if !rawScopes[s] && s != "comment" {
+				bad(r.pos, "rule: unknown scope '%s'", s)
+				continue
+			}
+			if rs.rules[s] == nil {
+				rs.rules[s] = shaper.NewFilter()
+			}
+			rs.rules[s].ApplyRegexpReplaceAll(r.Regexp, r.Replace)
+		}
+	}
+
+	for _, e := range rawRule.Extract {
+		x := &rawExtractor{RawExtract: e, scope: map[string]bool{}}
+		re, err := regexp.Compile(e.Regexp)
+		if err != nil {
+			bad(e.pos, "extract %s: %v", e.Name, err)
+			continue
+		}
+		if re.NumSubexp() < 1 {
+			bad(e.pos, "extract %s: regexp has no submatch to capture", e.Name)
+			continue
+		}
+		x.rexp = re
+		for _, s := range e.Scope {
+			if !rawScopes[s] {
+				bad(e.pos, "extract %s: unknown scope '%s'", e.Name, s)
+			}
+			x.scope[s] = true
+		}
+		rs.extractors = append(rs.extractors, x)
+	}
+
+	for _, r := range rawRule.Summarize {
+		if _, err := regexp.Compile(r.Regexp); err != nil {
+			bad(r.pos, "summarize: %v", err)
+			continue
+		}
+		rs.summarize.ApplyRegexpReplaceAll(r.Regexp, r.Replace)
+	}
+
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("bad .rawrule rules:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return rs, nil
+}
+
+// LoadRawRule reads the .rawrule file and its included ones
+func LoadRawRule(filename string) (*RawRule, error) {
+	var rawRule RawRule
+	if err := rawRuleLoad(filename, &rawRule, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return &rawRule, nil
+}
+
+// Validate reports each bad rule by its position
+func (rawRule *RawRule) Validate() error {
+	_, err := rawRuleApply(rawRule)
+	return err
+}
+
+// Encode writes the rules out as a .rawrule file
+func (rawRule *RawRule) Encode(w io.Writer) error {
+	e := yaml.NewEncoder(w)
+	e.SetIndent(2)
+	if err := e.Encode(rawRule); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+// Test checks the examples of the rules, once they are applied, reporting
+// the failed ones to w
+func (rawRule *RawRule) Test(w io.Writer) (failed, total int, err error) {
+	rs, err := rawRuleApply(rawRule)
+	if err != nil {
+		return 0, 0, err
+	}
+	fail := func(pos, what string, ex RawExample, got string) {
+		failed++
+		fmt.Fprintf(w, "FAIL %s: %s\n  input:  %q\n  want:   %q\n  got:    %q\n",
+			pos, what, ex.Input, ex.Output, got)
+	}
+
+	for _, r := range rawRule.Rules {
+		if r.Enabled != nil && !*r.Enabled {
+			continue
+		}
+		scope := r.Scope
+		if len(scope) == 0 {
+			scope = []string{"body"}
+		}
+		for _, s := range scope {
+			for _, ex := range r.Examples {
+				total++
+				if got := rs.apply(s, ex.Input); got != ex.Output {
+					fail(r.pos, "rule ("+s+")", ex, got)
+				}
+			}
+		}
+	}
+
+	for _, x := range rs.extractors {
+		for _, ex := range x.Examples {
+			total++
+			got := ""
+			if m := x.rexp.FindStringSubmatch(ex.Input); len(m) > 1 {
+				got = m[1]
+			}
+			if got != ex.Output {
+				fail(x.pos, "extract "+x.Name, ex, got)
+			}
+		}
+	}
+	return
+}
+
+// apply applies the replace rules of the scope to v
+func (rs *rawState) apply(scope, v string) string {
+	if rules, ok := rs.rules[scope]; ok {
+		return rules.Process(v)
+	}
+	return v
+}
+
+// value captures the dynamic values not found yet from v, if it is in
+// their scope, then replaces all the values found so far in v
+func (rs *rawState) value(scope, v string) string {
+	for _, x := range rs.extractors {
+		if len(x.value) != 0 || !x.scope[scope] {
+			continue
+		}
+		if m := x.rexp.FindStringSubmatch(v); len(m) > 1 && len(m[1]) != 0 {
+			x.value = m[1]
+			rs.found.ApplyReplace(x.value, x.Placeholder, -1)
+		}
+	}
+	return rs.found.Process(v)
+}
+
+// reset forgets the dynamic values found in the previous script
+func (rs *rawState) reset() {
+	for _, x := range rs.extractors {
+		x.value = ""
+	}
+	rs.found = shaper.NewFilter()
+}
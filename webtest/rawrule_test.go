@@ -0,0 +1,377 @@
+package webtest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRawRules writes the .rawrule files, by their names, into a new
+// temporary directory, which is returned
+func writeRawRules(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "wts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// rawStateOf reads the .rawrule content into the rules in action
+func rawStateOf(t *testing.T, content string) *rawState {
+	dir := writeRawRules(t, map[string]string{"a.rawrule": content})
+	defer os.RemoveAll(dir)
+	rs, err := rawRuleRead(filepath.Join(dir, "a.rawrule"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func TestRawExtract(t *testing.T) {
+	type step struct{ scope, in, want string }
+	tests := []struct {
+		name  string
+		rules string
+		steps []step
+	}{
+		{"default DF values", "", []step{
+			{"url", "http://a/force/u/CB42/x", "http://a/force/u/{{Param_ClientBrowserId}}/x"},
+			{"body", "<SessionTicket>ABC</SessionTicket><Id>CB42</Id>",
+				"<SessionTicket>{{Param_SessionId}}</SessionTicket><Id>{{Param_ClientBrowserId}}</Id>"},
+			{"query", "ABC", "{{Param_SessionId}}"},
+		}},
+		{"first capture only, within the scope", `extract:
+  - name: Token
+    regexp: 'token=(\w+)'
+    scope: [query, form]
+    placeholder: '{{Token}}'
+`, []step{
+			{"url", "x?token=t1", "x?token=t1"},
+			{"form", "token=t2", "token={{Token}}"},
+			{"query", "token=t3 t2", "token=t3 {{Token}}"},
+			{"url", "x/t2", "x/{{Token}}"},
+		}},
+		{"empty capture skipped", `extract:
+  - name: Id
+    regexp: 'id=(\d*)'
+    scope: [body]
+    placeholder: '{{Id}}'
+`, []step{
+			{"body", "id=", "id="},
+			{"body", "id=42", "id={{Id}}"},
+			{"body", "id=4242", "id={{Id}}{{Id}}"},
+		}},
+	}
+	for _, tt := range tests {
+		rs := rawStateOf(t, tt.rules)
+		for i, s := range tt.steps {
+			if got := rs.value(s.scope, s.in); got != s.want {
+				t.Errorf("%s, step %d: got %q, want %q", tt.name, i+1, got, s.want)
+			}
+		}
+		rs.reset()
+		if s := tt.steps[len(tt.steps)-1]; rs.value("header", s.in) != s.in {
+			t.Errorf("%s: the values not forgotten after reset", tt.name)
+		}
+	}
+}
+
+func TestRawSummarize(t *testing.T) {
+	df := "<Request><ReadableCorrelator>corr-1</ReadableCorrelator><More/></Request>"
+	dfGet := "<Request><ReadableRequestName>Get</ReadableRequestName><RequestName>Thing</RequestName>" +
+		"<Arg>&lt;MethodName&gt;Load&lt;/MethodName&gt;</Arg></Request>"
+	tests := []struct {
+		name, rules, body, want string
+	}{
+		{"default correlator", "", df, "corr-1"},
+		{"default Get request", "", dfGet, "Get.Thing.Load"},
+		{"own rules in order", `summarize:
+  '.*<Op>|</Op>.*': ''
+  '^(\w+)$': 'op:$1'
+`, "<a><Op>Save</Op></a>", "op:Save"},
+		{"own rules replace the default ones", "summarize:\n  '^x$': 'y'\n", df, df},
+	}
+	for _, tt := range tests {
+		rs := rawStateOf(t, tt.rules)
+		if got := rs.summarize.Process(tt.body); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRawDump(t *testing.T) {
+	text := string(dumpSample(t, DumpOptions{Raw: true, RawRule: os.DevNull}))
+	for _, want := range []string{
+		"G: (0,0) {{Param_TestServer}}/force/u/{{Param_ClientBrowserId}}/Account/LogOn ():True\r\n",
+		"P: (0,0) {{Param_TestServer}}/api/Service.svc corr-1 (Svc):True\r\n",
+		"<SessionTicket>{{Param_SessionId}}</SessionTicket>",
+		"  C: [] in loop\r\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("no %q in\n%s", want, text)
+		}
+	}
+}
+
+func TestRawRules(t *testing.T) {
+	rules := `replace:
+  '<(RoleId)>\w+</(RoleId)>': '<$1>--</$2>'
+rules:
+  - regexp: '[?&]_=\d+'
+    replace: ''
+    scope: [url, query]
+  - regexp: 'a'
+    replace: 'b'
+    scope: [form]
+  - regexp: 'b'
+    replace: 'c'
+    scope: [form]
+  - regexp: '\[#\d+\] *'
+    scope: [comment]
+  - regexp: 'x'
+    replace: 'y'
+    scope: [url]
+    enabled: false
+`
+	tests := []struct {
+		scope, in, want string
+	}{
+		{"body", "<RoleId>42</RoleId>", "<RoleId>--</RoleId>"},
+		{"url", "a.aspx?x=1&_=1464021817113", "a.aspx?x=1"},
+		{"query", "?_=1", ""},
+		{"body", "a.aspx?_=1", "a.aspx?_=1"},
+		{"form", "a", "c"},
+		{"comment", "[#12] login", "login"},
+		{"url", "x", "x"},
+		{"header", "a", "a"},
+	}
+	rs := rawStateOf(t, rules)
+	for _, tt := range tests {
+		if got := rs.apply(tt.scope, tt.in); got != tt.want {
+			t.Errorf("%s %q: got %q, want %q", tt.scope, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRawRuleErrors(t *testing.T) {
+	tests := []struct {
+		rules string
+		errs  []string
+	}{
+		{"rules:\n  - regexp: '('\n  - regexp: 'a'\n    scope: [nowhere]\n",
+			[]string{"a.rawrule:2: rule: error parsing regexp",
+				"a.rawrule:3: rule: unknown scope 'nowhere'"}},
+		{"replace:\n  'ok': ''\n  '[': ''\n",
+			[]string{"a.rawrule:3: rule: error parsing regexp"}},
+		{"extract:\n  - name: Id\n    regexp: 'id=\\d+'\n    scope: [body]\n",
+			[]string{"a.rawrule:2: extract Id: regexp has no submatch"}},
+		{"summarize:\n  '*': ''\n", []string{"a.rawrule:2: summarize:"}},
+		{"unknown: 1\n", []string{"a.rawrule:1: unknown section 'unknown'"}},
+		{"- a\n", []string{"a.rawrule:1: not a mapping of rule sections"}},
+		{"rules: [\n", []string{"a.rawrule: yaml:"}},
+	}
+	for _, tt := range tests {
+		dir := writeRawRules(t, map[string]string{"a.rawrule": tt.rules})
+		_, err := rawRuleRead(filepath.Join(dir, "a.rawrule"), false)
+		os.RemoveAll(dir)
+		if err == nil {
+			t.Errorf("%q: no error", tt.rules)
+			continue
+		}
+		for _, e := range tt.errs {
+			if !strings.Contains(err.Error(), e) {
+				t.Errorf("%q: error %v, want %q", tt.rules, err, e)
+			}
+		}
+	}
+}
+
+func TestRawInclude(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		in    string
+		want  string
+		err   string
+	}{
+		{"included first", map[string]string{
+			"a.rawrule":      "include: base/b.rawrule\nreplace:\n  'x': 'y'\n",
+			"base/b.rawrule": "replace:\n  'w': 'x'\n",
+		}, "w", "y", ""},
+		{"diamond", map[string]string{
+			"a.rawrule": "include: [b.rawrule, c.rawrule]\n",
+			"b.rawrule": "include: d.rawrule\nreplace:\n  'b': 'B'\n",
+			"c.rawrule": "include: d.rawrule\nreplace:\n  'c': 'C'\n",
+			"d.rawrule": "replace:\n  'd': 'D'\n",
+		}, "bcd", "BCD", ""},
+		{"cycle", map[string]string{
+			"a.rawrule": "include: b.rawrule\n",
+			"b.rawrule": "include: a.rawrule\n",
+		}, "", "", "a.rawrule: included by itself"},
+		{"missing", map[string]string{
+			"a.rawrule": "include: none.rawrule\n",
+		}, "", "", "none.rawrule: no such file"},
+	}
+	for _, tt := range tests {
+		dir := writeRawRules(t, tt.files)
+		rs, err := rawRuleRead(filepath.Join(dir, "a.rawrule"), false)
+		os.RemoveAll(dir)
+		if len(tt.err) != 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if got := rs.apply("body", tt.in); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRawRuleFile(t *testing.T) {
+	dir := writeRawRules(t, map[string]string{
+		"a.rawrule": "replace:\n  'x': 'y'\n", "b.rawrule": "replace:\n  'x': 'z'\n",
+	})
+	defer os.RemoveAll(dir)
+	in := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name, script, rawRule string
+		used, x, err          string
+	}{
+		{"next to the script", in("a.webtest"), "", in("a.rawrule"), "y", ""},
+		{"none next to the script", in("c.webtest"), "", "", "x", ""},
+		{"given", in("a.webtest"), in("b.rawrule"), in("b.rawrule"), "z", ""},
+		{"given but missing", in("a.webtest"), in("none.rawrule"), "", "",
+			"none.rawrule: no such file"},
+		{"stdin", StdinName, "", "", "x", ""},
+		{"stdin given", StdinName, in("b.rawrule"), in("b.rawrule"), "z", ""},
+	}
+	for _, tt := range tests {
+		dp, err := NewDumper(tt.script, DumpOptions{Raw: true, RawRule: tt.rawRule})
+		if len(tt.err) != 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if dp.RawRule() != tt.used {
+			t.Errorf("%s: used %q, want %q", tt.name, dp.RawRule(), tt.used)
+		}
+		if got := dp.Value("body", "x"); got != tt.x {
+			t.Errorf("%s: x dumped as %q, want %q", tt.name, got, tt.x)
+		}
+	}
+}
+
+func TestRawStructured(t *testing.T) {
+	dir := writeRawRules(t, map[string]string{"a.rawrule": `rules:
+  - regexp: '\d+/\d+/20\d\d'
+    replace: '-date-'
+    scope: [query]
+  - regexp: '^bob$'
+    replace: '-user-'
+    scope: [form]
+`})
+	defer os.RemoveAll(dir)
+	var doc dumpDocument
+	err := json.Unmarshal(dumpSample(t, DumpOptions{Raw: true, Format: "json",
+		RawRule: filepath.Join(dir, "a.rawrule")}), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := doc.Requests[0]
+	tests := []struct {
+		name, got, want string
+	}{
+		{"query", login.Query[1].Value, "-date-"},
+		{"form", doc.Requests[2].Form[0].Value, "-user-"},
+		{"url", login.Url, "{{Param_TestServer}}/force/u/{{Param_ClientBrowserId}}/Account/LogOn"},
+		{"think time", login.ThinkTime, "0"},
+		{"comment", login.Comment, "[] start"},
+		{"body", doc.Requests[1].Body[:40], "<Request><ReadableCorrelator>corr-1</Rea"},
+		{"service", doc.Requests[1].Service, "corr-1"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestRawRuleTest(t *testing.T) {
+	dir := writeRawRules(t, map[string]string{
+		"base.rawrule": `rules:
+  - regexp: '[?&]_=\d+'
+    replace: ''
+    scope: [url, query]
+`,
+		"a.rawrule": `include: base.rawrule
+rules:
+  - regexp: '/u/\w+/'
+    replace: '/u/-/'
+    scope: [url]
+    examples:
+      - input: 'a/u/CB42/b?_=1'
+        output: 'a/u/-/b'
+      - input: 'a/u/CB42/b'
+        output: 'a/u/CB42/b'
+  - regexp: 'x'
+    replace: 'y'
+    enabled: false
+    examples:
+      - input: 'x'
+        output: 'z'
+extract:
+  - name: Ticket
+    regexp: '<T>(.*?)</T>'
+    scope: [body]
+    placeholder: '{{T}}'
+    examples:
+      - input: '<T>abc</T>'
+        output: 'abc'
+      - input: '<T>abc</T>'
+        output: 'abd'
+`})
+	defer os.RemoveAll(dir)
+	rawRule, err := LoadRawRule(filepath.Join(dir, "a.rawrule"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	failed, total, err := rawRule.Test(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != 2 || total != 4 {
+		t.Errorf("%d of %d failed, want 2 of 4", failed, total)
+	}
+	want := "FAIL " + filepath.Join(dir, "a.rawrule") + `:3: rule (url)
+  input:  "a/u/CB42/b"
+  want:   "a/u/CB42/b"
+  got:    "a/u/-/b"
+FAIL ` + filepath.Join(dir, "a.rawrule") + `:18: extract Ticket
+  input:  "<T>abc</T>"
+  want:   "abd"
+  got:    "abc"
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,428 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wtXml - web test XML file structs
+// authors: Antonio Sun (c) 2015-16, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+// Package webtest models the Visual Studio web test scripts, the .webtest
+// files, and dumps and checks them. The wts command is a thin wrapper of it
+package webtest
+
+import (
+	"encoding/xml"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// progname is how the messages and reports name the tool
+const progname = "wts"
+
+/*
+  The structs below model the whole .webtest document. Attributes are
+  declared in the order Visual Studio writes them, and anything not
+  modeled explicitly is kept in the Attrs/Unknown catch-alls, so that a
+  decoded web test can be encoded back without losing information.
+*/
+
+/*
+<WebTest Name="WebTest1" Id="b3b5e0c2-..." Owner="" Priority="2147483647" Enabled="True" CssProjectStructure="" CssIteration="" Timeout="0" WorkItemIds="" xmlns="http://microsoft.com/schemas/VisualStudio/TeamTest/2010" Description="" CredentialUserName="" CredentialPassword="" PreAuthenticate="True" Proxy="default" StopOnError="False" RecordedResultFile="WebTest1.....webtestResult" ResultsLocale="">
+  <Items>
+  ...
+  </Items>
+  <DataSources> ... </DataSources>
+  <ContextParameters> ... </ContextParameters>
+  <ValidationRules> ... </ValidationRules>
+  <WebTestPlugins> ... </WebTestPlugins>
+</WebTest>
+*/
+type WebTest struct {
+	Name                string     `xml:"Name,attr"`
+	Id                  string     `xml:"Id,attr,omitempty"`
+	Owner               string     `xml:"Owner,attr"`
+	Priority            string     `xml:"Priority,attr"`
+	Enabled             string     `xml:"Enabled,attr"`
+	CssProjectStructure string     `xml:"CssProjectStructure,attr"`
+	CssIteration        string     `xml:"CssIteration,attr"`
+	Timeout             string     `xml:"Timeout,attr"`
+	WorkItemIds         string     `xml:"WorkItemIds,attr"`
+	Xmlns               string     `xml:"xmlns,attr,omitempty"`
+	Description         string     `xml:"Description,attr"`
+	CredentialUserName  string     `xml:"CredentialUserName,attr"`
+	CredentialPassword  string     `xml:"CredentialPassword,attr"`
+	PreAuthenticate     string     `xml:"PreAuthenticate,attr"`
+	Proxy               string     `xml:"Proxy,attr"`
+	StopOnError         string     `xml:"StopOnError,attr"`
+	RecordedResultFile  string     `xml:"RecordedResultFile,attr,omitempty"`
+	ResultsLocale       string     `xml:"ResultsLocale,attr"`
+	Attrs               []xml.Attr `xml:",any,attr"`
+
+	Items             Items              `xml:"Items"`
+	DataSources       []DataSource       `xml:"DataSources>DataSource"`
+	ContextParameters []ContextParameter `xml:"ContextParameters>ContextParameter"`
+	ValidationRules   []ValidationRule   `xml:"ValidationRules>ValidationRule"`
+	WebTestPlugins    []WebTestPlugin    `xml:"WebTestPlugins>WebTestPlugin"`
+	Unknown           []Node             `xml:",any"`
+}
+
+// Items holds the ordered, mixed children of an <Items> element:
+// *Comment, *Request, *TransactionTimer, *Condition, *Loop,
+// *IncludedWebTest, or *Node for anything else
+type Items []Item
+
+// Item is any element that can appear within <Items>
+type Item interface {
+	itemName() string
+}
+
+/*
+<Comment CommentText="[#30]" />
+*/
+type Comment struct {
+	CommentText string     `xml:"CommentText,attr"`
+	Attrs       []xml.Attr `xml:",any,attr"`
+}
+
+/*
+  <ContextParameters>
+    <ContextParameter Name="web" Value="http://localhost:50357/" />
+  </ContextParameters>
+*/
+type ContextParameter struct {
+	Name  string     `xml:"Name,attr"`
+	Value string     `xml:"Value,attr"`
+	Attrs []xml.Attr `xml:",any,attr"`
+}
+
+/*
+   <DataSource Name="DataSource1" Provider="Microsoft.VisualStudio.TestTools.DataSource.CSV" Connection="|DataDirectory|\.\Data\text.csv">
+     <Tables>
+       <DataSourceTable Name="text#csv" SelectColumns="SelectOnlyBoundColumns" AccessMethod="Sequential" />
+     </Tables>
+   </DataSource>
+*/
+type DataSource struct {
+	Name       string            `xml:"Name,attr"`
+	Provider   string            `xml:"Provider,attr"`
+	Connection string            `xml:"Connection,attr"`
+	Attrs      []xml.Attr        `xml:",any,attr"`
+	Tables     []DataSourceTable `xml:"Tables>DataSourceTable"`
+	Unknown    []Node            `xml:",any"`
+}
+
+type DataSourceTable struct {
+	Name          string     `xml:"Name,attr"`
+	SelectColumns string     `xml:"SelectColumns,attr"`
+	AccessMethod  string     `xml:"AccessMethod,attr"`
+	Attrs         []xml.Attr `xml:",any,attr"`
+}
+
+/*
+   <RuleParameters>
+     <RuleParameter Name="Tolerance" Value="0" />
+   </RuleParameters>
+*/
+type RuleParameter struct {
+	Name  string     `xml:"Name,attr"`
+	Value string     `xml:"Value,attr"`
+	Attrs []xml.Attr `xml:",any,attr"`
+}
+
+/*
+   <ConditionalRule Classname="Microsoft.VisualStudio.TestTools.WebTesting.Rules.NumericalComparisonRule, Microsoft.VisualStudio.QualityTools.WebTestFramework, Version=10.0.0.0, Culture=neutral, PublicKeyToken=b03f5f7f11d50a3a" DisplayName="Number Comparison" Description="The condition is met when the value of the context parameter satisfies the comparison with the provided value.">
+     <RuleParameters>
+       <RuleParameter Name="ContextParameterName" Value="Ver" />
+       <RuleParameter Name="ComparisonOperator" Value="==" />
+       <RuleParameter Name="Value" Value="2.1" />
+     </RuleParameters>
+   </ConditionalRule>
+
+  The MaxIterations and AdvanceDataCursors only present for Loop rules.
+*/
+type ConditionalRule struct {
+	Classname          string          `xml:"Classname,attr"`
+	DisplayName        string          `xml:"DisplayName,attr"`
+	Description        string          `xml:"Description,attr"`
+	MaxIterations      string          `xml:"MaxIterations,attr,omitempty"`
+	AdvanceDataCursors string          `xml:"AdvanceDataCursors,attr,omitempty"`
+	Attrs              []xml.Attr      `xml:",any,attr"`
+	RuleParameters     []RuleParameter `xml:"RuleParameters>RuleParameter"`
+	Unknown            []Node          `xml:",any"`
+}
+
+/*
+   <Condition UniqueStringId="...">
+     <ConditionalRule ...> ... </ConditionalRule>
+     <Then>
+       <Items> ... </Items>
+     </Then>
+     <Else />
+   </Condition>
+*/
+type Condition struct {
+	UniqueStringId  string           `xml:"UniqueStringId,attr"`
+	Attrs           []xml.Attr       `xml:",any,attr"`
+	ConditionalRule *ConditionalRule `xml:"ConditionalRule"`
+	Then            *Branch          `xml:"Then"`
+	Else            *Branch          `xml:"Else"`
+	Unknown         []Node           `xml:",any"`
+}
+
+// Branch is the Then or Else part of a Condition
+type Branch struct {
+	Items Items `xml:"Items,omitempty"`
+}
+
+/*
+   <Loop UniqueStringId="...">
+     <ConditionalRule ... MaxIterations="-1" AdvanceDataCursors="False"> ... </ConditionalRule>
+     <Items> ... </Items>
+   </Loop>
+*/
+type Loop struct {
+	UniqueStringId  string           `xml:"UniqueStringId,attr"`
+	Attrs           []xml.Attr       `xml:",any,attr"`
+	ConditionalRule *ConditionalRule `xml:"ConditionalRule"`
+	Items           Items            `xml:"Items"`
+	Unknown         []Node           `xml:",any"`
+}
+
+/*
+   <TransactionTimer Name="the transaction name">
+     <Items> ... </Items>
+   </TransactionTimer>
+*/
+type TransactionTimer struct {
+	Name    string     `xml:"Name,attr"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Items   Items      `xml:"Items"`
+	Unknown []Node     `xml:",any"`
+
+	offset int64
+}
+
+// <IncludedWebTest Name="..." Path="..." Id="..." IsCodedWebTest="False" InheritWebTestSettings="False" />
+type IncludedWebTest struct {
+	Name                   string     `xml:"Name,attr"`
+	Path                   string     `xml:"Path,attr,omitempty"`
+	Id                     string     `xml:"Id,attr,omitempty"`
+	IsCodedWebTest         string     `xml:"IsCodedWebTest,attr,omitempty"`
+	InheritWebTestSettings string     `xml:"InheritWebTestSettings,attr,omitempty"`
+	Attrs                  []xml.Attr `xml:",any,attr"`
+}
+
+/*
+  <ValidationRules>
+    <ValidationRule Classname="Microsoft.VisualStudio.TestTools.WebTesting.Rules.ValidateResponseUrl, Microsoft.VisualStudio.QualityTools.WebTestFramework, Version=10.0.0.0, Culture=neutral, PublicKeyToken=b03f5f7f11d50a3a" DisplayName="Response URL" Description="Validates that the response URL after redirects are followed is the same as the recorded response URL.  QueryString parameters are ignored." Level="Low" ExectuionOrder="BeforeDependents" />
+    <ValidationRule Classname="Microsoft.VisualStudio.TestTools.WebTesting.Rules.ValidationRuleResponseTimeGoal, Microsoft.VisualStudio.QualityTools.WebTestFramework, Version=10.0.0.0, Culture=neutral, PublicKeyToken=b03f5f7f11d50a3a" DisplayName="Response Time Goal" Description="Validates that the response time for the request is less than or equal to the response time goal as specified on the request.  Response time goals of zero will be ignored." Level="Low" ExectuionOrder="AfterDependents">
+      <RuleParameters>
+        <RuleParameter Name="Tolerance" Value="0" />
+      </RuleParameters>
+    </ValidationRule>
+  </ValidationRules>
+*/
+type ValidationRule struct {
+	Classname      string          `xml:"Classname,attr"`
+	DisplayName    string          `xml:"DisplayName,attr"`
+	Description    string          `xml:"Description,attr"`
+	Level          string          `xml:"Level,attr,omitempty"`
+	ExectuionOrder string          `xml:"ExectuionOrder,attr,omitempty"`
+	Attrs          []xml.Attr      `xml:",any,attr"`
+	RuleParameters []RuleParameter `xml:"RuleParameters>RuleParameter"`
+	Unknown        []Node          `xml:",any"`
+}
+
+/*
+   <ExtractionRules>
+     <ExtractionRule Classname="Microsoft.VisualStudio.TestTools.WebTesting.Rules.ExtractHiddenFields, Microsoft.VisualStudio.QualityTools.WebTestFramework, Version=10.0.0.0, Culture=neutral, PublicKeyToken=b03f5f7f11d50a3a" VariableName="1" DisplayName="Extract Hidden Fields" Description="Extract all hidden fields from the response and place them into the test context.">
+       <RuleParameters>
+         <RuleParameter Name="Required" Value="True" />
+         <RuleParameter Name="HtmlDecode" Value="True" />
+       </RuleParameters>
+     </ExtractionRule>
+   </ExtractionRules>
+*/
+type ExtractionRule struct {
+	Classname      string          `xml:"Classname,attr"`
+	VariableName   string          `xml:"VariableName,attr"`
+	DisplayName    string          `xml:"DisplayName,attr"`
+	Description    string          `xml:"Description,attr"`
+	Attrs          []xml.Attr      `xml:",any,attr"`
+	RuleParameters []RuleParameter `xml:"RuleParameters>RuleParameter"`
+	Unknown        []Node          `xml:",any"`
+}
+
+/*
+   <RequestPlugins>
+     <RequestPlugin Classname="Microsoft.VisualStudio.WebTesting.PowerTools.SharePoint.MTSL.General.SPLTPT_MTSL_SetContextParameterValue, Microsoft.VisualStudio.QualityTools.WebTestFramework, Version=10.0.0.0, Culture=neutral, PublicKeyToken=b03f5f7f11d50a3a" DisplayName="Set Context Parameter Value" Description="Allows you to set a context parameter value for this request.">
+       <RuleParameters>
+         <RuleParameter Name="Enabled" Value="True" />
+         <RuleParameter Name="sContextParameterName" Value="deviceName" />
+         <RuleParameter Name="sContextParameterValue" Value="DevA" />
+         ...
+       </RuleParameters>
+     </RequestPlugin>
+   </RequestPlugins>
+
+  The <WebTestPlugins> at the WebTest level have the same layout.
+*/
+type Plugin struct {
+	Classname      string          `xml:"Classname,attr"`
+	DisplayName    string          `xml:"DisplayName,attr"`
+	Description    string          `xml:"Description,attr"`
+	Attrs          []xml.Attr      `xml:",any,attr"`
+	RuleParameters []RuleParameter `xml:"RuleParameters>RuleParameter"`
+	Unknown        []Node          `xml:",any"`
+}
+
+type RequestPlugin struct {
+	Plugin
+}
+
+type WebTestPlugin struct {
+	Plugin
+}
+
+/*
+   <Headers>
+     <Header Name="SOAPAction" Value="&quot;http://tempuri.org/IService/GetData&quot;" />
+   </Headers>
+*/
+type Header struct {
+	Name  string     `xml:"Name,attr"`
+	Value string     `xml:"Value,attr"`
+	Attrs []xml.Attr `xml:",any,attr"`
+}
+
+/*
+   <QueryStringParameters>
+     <QueryStringParameter Name="v" Value="SoftwareVersion" RecordedValue="" CorrelationBinding="" UrlEncode="True" UseToGroupResults="False" />
+     <QueryStringParameter Name="xref" Value="RRR" RecordedValue="" CorrelationBinding="" UrlEncode="True" UseToGroupResults="False" />
+   </QueryStringParameters>
+*/
+type QueryStringParameter struct {
+	Name               string     `xml:"Name,attr"`
+	Value              string     `xml:"Value,attr"`
+	RecordedValue      string     `xml:"RecordedValue,attr"`
+	CorrelationBinding string     `xml:"CorrelationBinding,attr"`
+	UrlEncode          string     `xml:"UrlEncode,attr"`
+	UseToGroupResults  string     `xml:"UseToGroupResults,attr,omitempty"`
+	Attrs              []xml.Attr `xml:",any,attr"`
+}
+
+/*
+   <FormPostHttpBody>
+     <FormPostParameter Name="N" Value="A=" RecordedValue="" CorrelationBinding="" UrlEncode="False" />
+     <FileUploadParameter Name="file" FileName="a.txt" ContentType="text/plain" GenerateUniqueName="False" UseGuids="False" />
+   </FormPostHttpBody>
+*/
+type FormPostHttpBody struct {
+	FormPostParameter   []FormPostParameter   `xml:"FormPostParameter"`
+	FileUploadParameter []FileUploadParameter `xml:"FileUploadParameter"`
+	Unknown             []Node                `xml:",any"`
+}
+
+type FormPostParameter struct {
+	Name               string     `xml:"Name,attr"`
+	Value              string     `xml:"Value,attr"`
+	RecordedValue      string     `xml:"RecordedValue,attr"`
+	CorrelationBinding string     `xml:"CorrelationBinding,attr"`
+	UrlEncode          string     `xml:"UrlEncode,attr"`
+	Attrs              []xml.Attr `xml:",any,attr"`
+}
+
+type FileUploadParameter struct {
+	Name        string     `xml:"Name,attr"`
+	FileName    string     `xml:"FileName,attr"`
+	ContentType string     `xml:"ContentType,attr"`
+	Attrs       []xml.Attr `xml:",any,attr"`
+}
+
+/*
+   <StringHttpBody ContentType="text/xml" InsertByteOrderMark="False">PAA...</StringHttpBody>
+
+  The body is base64 encoded UTF-16, see DecodeStringBody.
+*/
+type StringHttpBody struct {
+	ContentType         string     `xml:"ContentType,attr"`
+	InsertByteOrderMark string     `xml:"InsertByteOrderMark,attr,omitempty"`
+	Attrs               []xml.Attr `xml:",any,attr"`
+	Body                string     `xml:",chardata"`
+}
+
+/*
+<BinaryHttpBody ContentType="application/octet-stream">AAEC...</BinaryHttpBody>
+*/
+type BinaryHttpBody struct {
+	ContentType string     `xml:"ContentType,attr"`
+	Attrs       []xml.Attr `xml:",any,attr"`
+	Data        string     `xml:",chardata"`
+}
+
+type Request struct {
+	/*
+	   <Request Method="GET" Guid="..." Version="1.1" Url="{{web}}Account/LogOn" ThinkTime="0" Timeout="300" ParseDependentRequests="True" FollowRedirects="True" RecordResult="True" Cache="False" ResponseTimeGoal="0" Encoding="utf-8" ExpectedHttpStatusCode="0" ExpectedResponseUrl="" ReportingName="" IgnoreHttpStatusCode="False">
+	*/
+	Method                 string     `xml:"Method,attr"`
+	Guid                   string     `xml:"Guid,attr,omitempty"`
+	Version                string     `xml:"Version,attr"`
+	Url                    string     `xml:"Url,attr"`
+	ThinkTime              string     `xml:"ThinkTime,attr"`
+	Timeout                string     `xml:"Timeout,attr"`
+	ParseDependentRequests string     `xml:"ParseDependentRequests,attr"`
+	FollowRedirects        string     `xml:"FollowRedirects,attr"`
+	RecordResult           string     `xml:"RecordResult,attr"`
+	Cache                  string     `xml:"Cache,attr"`
+	ResponseTimeGoal       string     `xml:"ResponseTimeGoal,attr"`
+	Encoding               string     `xml:"Encoding,attr"`
+	ExpectedHttpStatusCode string     `xml:"ExpectedHttpStatusCode,attr"`
+	ExpectedResponseUrl    string     `xml:"ExpectedResponseUrl,attr"`
+	ReportingName          string     `xml:"ReportingName,attr"`
+	IgnoreHttpStatusCode   string     `xml:"IgnoreHttpStatusCode,attr,omitempty"`
+	Attrs                  []xml.Attr `xml:",any,attr"`
+
+	Headers                    []Header         `xml:"Headers>Header"`
+	RequestPlugins             []RequestPlugin  `xml:"RequestPlugins>RequestPlugin"`
+	ExtractionRules            []ExtractionRule `xml:"ExtractionRules>ExtractionRule"`
+	ValidationRules            []ValidationRule `xml:"ValidationRules>ValidationRule"`
+	CorrelationExtractionRules []ExtractionRule `xml:"CorrelationExtractionRules>ExtractionRule"`
+	DependentRequests          []*Request       `xml:"DependentRequests>Request"`
+
+	/* The QueryStringParameters actually belongs to GET requests, and
+	   the bodies to POST ones, but all put here for convenience handling
+	   in dealReqAddons
+	*/
+	QueryStringParameters []QueryStringParameter `xml:"QueryStringParameters>QueryStringParameter"`
+	FormPostHttpBody      *FormPostHttpBody      `xml:"FormPostHttpBody"`
+	StringHttpBody        *StringHttpBody        `xml:"StringHttpBody"`
+	BinaryHttpBody        *BinaryHttpBody        `xml:"BinaryHttpBody"`
+	Unknown               []Node                 `xml:",any"`
+
+	offset int64 // where its start tag ends in the .webtest, for the positions
+}
+
+// NewRequest makes a GET request with the attributes Visual Studio gives to
+// a new one
+func NewRequest() *Request {
+	return &Request{Method: "GET", Version: "1.1", ThinkTime: "0",
+		Timeout: "300", ParseDependentRequests: "True", FollowRedirects: "True",
+		RecordResult: "True", Cache: "False", ResponseTimeGoal: "0",
+		Encoding: "utf-8", ExpectedHttpStatusCode: "0",
+		IgnoreHttpStatusCode: "False"}
+}
+
+// Node keeps any element not modeled above, as-is
+type Node struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+
+	offset int64
+}
+
+func (*Comment) itemName() string          { return "Comment" }
+func (*Request) itemName() string          { return "Request" }
+func (*TransactionTimer) itemName() string { return "TransactionTimer" }
+func (*Condition) itemName() string        { return "Condition" }
+func (*Loop) itemName() string             { return "Loop" }
+func (*IncludedWebTest) itemName() string  { return "IncludedWebTest" }
+func (n *Node) itemName() string           { return n.XMLName.Local }
@@ -0,0 +1,716 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wtXmlEnc - web test XML decoding and encoding
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+import (
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+const wtXmlHeader = `<?xml version="1.0" encoding="utf-8"?>`
+
+// xmlNode is a generic element tree, used to write XML out the way
+// Visual Studio does -- two-space indentation, CRLF line endings,
+// self-closing empty elements and &quot; in attribute values
+type xmlNode struct {
+	name     string
+	attr     []xml.Attr
+	text     string
+	children []*xmlNode
+
+	// the merge conflicts, the two sides in place of the node, or the
+	// start tag attributes of theirs, see Merge
+	conflict [][]*xmlNode
+	theirs   []xml.Attr
+}
+
+// wtListElems are the list containers in the model, which Visual Studio
+// does not write out when empty, but encoding/xml always does
+var wtListElems = map[string]bool{
+	"DataSources": true, "ContextParameters": true, "ValidationRules": true,
+	"WebTestPlugins": true, "Tables": true, "RuleParameters": true,
+	"Headers": true, "RequestPlugins": true, "ExtractionRules": true,
+	"CorrelationExtractionRules": true, "DependentRequests": true,
+	"QueryStringParameters": true,
+}
+
+var xmlAttrEscaper = strings.NewReplacer(
+	"&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;",
+	"\r", "&#xD;", "\n", "&#xA;", "\t", "&#x9;")
+var xmlTextEscaper = strings.NewReplacer(
+	"&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// Parse decodes a whole .webtest document into the WebTest model.
+// The errors tell the file name as well if r is a file
+func Parse(r io.Reader) (*WebTest, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	wt, errs := parseInput(newXmlInput(fileName(r), content), false)
+	if len(errs) != 0 {
+		return nil, errs[0]
+	}
+	return wt, nil
+}
+
+// fileName tells the file name of r, if it is a file
+func fileName(r io.Reader) string {
+	if f, ok := r.(interface{ Name() string }); ok {
+		return f.Name()
+	}
+	return ""
+}
+
+// parseInput decodes the web test from the input, which tells the
+// positions of the errors, and of the elements afterward. It stops at the
+// first error, but with keepGoing, an item that fails to decode is left
+// out with its error, and the rest of the items are decoded still. The
+// web test is nil if it can not be decoded at all
+func parseInput(in *xmlInput, keepGoing bool) (*WebTest, ErrorList) {
+	var errs ErrorList
+	text := in.text
+	for {
+		wt, err := in.decodeWebTest()
+		if err == nil {
+			return wt, errs
+		}
+		ie, ok := err.(*itemError)
+		if !ok {
+			return nil, append(errs, err)
+		}
+		name, end := element(text, ie.start)
+		errs = append(errs, in.errorAt(ie.start, "bad <"+name+"> element", ie.err))
+		if !keepGoing || end < 0 {
+			return nil, errs
+		}
+		// blank the element out, keeping the offsets, and decode again
+		text = append([]byte(nil), text...)
+		for i := ie.start; i < end; i++ {
+			if text[i] != '\n' {
+				text[i] = ' '
+			}
+		}
+		in.reset(text)
+	}
+}
+
+// decodeWebTest decodes the web test from the root element. The error of
+// an item within is an *itemError, the rest are *PosError
+func (in *xmlInput) decodeWebTest() (*WebTest, error) {
+	for {
+		offset := in.InputOffset()
+		token, err := in.Token()
+		if err == io.EOF {
+			return nil, in.errorAt(offset, "reading the web test",
+				fmt.Errorf("no root element"))
+		}
+		if err != nil {
+			return nil, in.errorAt(offset, "reading the web test", err)
+		}
+		if t, ok := token.(xml.StartElement); ok {
+			if t.Name.Local != "WebTest" {
+				return nil, in.errorAt(offset, "reading the web test",
+					fmt.Errorf("not a web test, root element is <%s>", t.Name.Local))
+			}
+			var wt WebTest
+			err := in.DecodeElement(&wt, &t)
+			if _, ok := err.(*itemError); ok {
+				return nil, err
+			}
+			if err != nil {
+				return nil, in.errorAt(offset, "bad <WebTest> element", err)
+			}
+			return &wt, nil
+		}
+	}
+}
+
+// ToUtf8 converts the XML content in UTF-8 with or without BOM, or in
+// UTF-16, little or big endian, to UTF-8 without BOM
+func ToUtf8(content []byte) []byte {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xEF, 0xBB, 0xBF}):
+		content = content[3:]
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		content = utf16ToUtf8(content[2:], binary.LittleEndian)
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		content = utf16ToUtf8(content[2:], binary.BigEndian)
+	// no BOM, sniff the "<" of the XML declaration
+	case bytes.HasPrefix(content, []byte{'<', 0}):
+		content = utf16ToUtf8(content, binary.LittleEndian)
+	case bytes.HasPrefix(content, []byte{0, '<'}):
+		content = utf16ToUtf8(content, binary.BigEndian)
+	}
+	return content
+}
+
+// decodeText converts the content to UTF-8, by its BOM, or else by the
+// encoding in its XML declaration, so that the decoder offsets and the
+// error positions are both of the decoded text. An unknown encoding is
+// left for the decoder to tell
+func decodeText(content []byte) []byte {
+	text := ToUtf8(content)
+	m := xmlEncodingRe.FindSubmatch(text)
+	if m == nil || strings.EqualFold(string(m[1]), "utf-8") {
+		return text
+	}
+	r, err := charsetReader(string(m[1]), bytes.NewReader(text))
+	if err != nil {
+		return text
+	}
+	decoded, err := ioutil.ReadAll(r)
+	if err != nil {
+		return text
+	}
+	return decoded
+}
+
+var xmlEncodingRe = regexp.MustCompile(`^<\?xml[^>]*\sencoding\s*=\s*["']([^"']*)["']`)
+
+// charsetReader is only called for the encodings other than UTF-8 in the
+// XML declaration. The UTF-16 ones are converted by ToUtf8 already. The
+// rest are looked up the way the browsers do, so the windows-1252 that
+// Visual Studio saves in is known by all its names, and the latin1 ones
+// are taken as windows-1252 too
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(label) {
+	case "utf-16", "utf-16le", "utf-16be", "unicode", "us-ascii", "ascii":
+		return input, nil
+	}
+	e, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported encoding '%s'", label)
+	}
+	return e.NewDecoder().Reader(input), nil
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Input with error positions
+
+// PosError is an error at a position of the input file
+type PosError struct {
+	File string
+	Line int
+	Col  int
+	Msg  string // the failure class, i.e., what was being read
+	Err  error
+}
+
+func (e *PosError) Error() string {
+	pos := fmt.Sprintf("%d:%d", e.Line, e.Col)
+	if len(e.File) != 0 {
+		pos = e.File + ":" + pos
+	}
+	return fmt.Sprintf("%s: %s: %v", pos, e.Msg, e.Err)
+}
+
+// ErrorList holds all the errors found in --keep-going mode
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// xmlInput is a XML decoder that tells the positions of the errors
+type xmlInput struct {
+	*xml.Decoder
+	name string
+	text []byte // the input, decoded to UTF-8
+}
+
+// itemError is the error of an item element that fails to decode, which
+// starts at the offset
+type itemError struct {
+	start int64
+	err   error
+}
+
+func (e *itemError) Error() string {
+	return e.err.Error()
+}
+
+// newXmlInput makes a XML decoder for the content in any encoding that
+// Visual Studio can save a .webtest in. The decoded text is always UTF-8
+func newXmlInput(name string, content []byte) *xmlInput {
+	in := &xmlInput{name: name, text: decodeText(content)}
+	in.reset(in.text)
+	return in
+}
+
+// reset makes the decoder read the text from the start. The text is the
+// input, or the input with the bad items blanked out
+func (in *xmlInput) reset(text []byte) {
+	in.Decoder = xml.NewDecoder(bytes.NewReader(text))
+	// decoded by decodeText already, but the unknown encodings still fail
+	in.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		if _, err := charsetReader(label, input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	}
+}
+
+// errorAt makes a PosError of err at the offset, i.e., where the element
+// in question starts, or where the decoder is for the XML syntax errors
+func (in *xmlInput) errorAt(offset int64, msg string, err error) *PosError {
+	if offset > int64(len(in.text)) {
+		offset = int64(len(in.text))
+	}
+	// the offset before a token is at the white spaces before it
+	for offset < int64(len(in.text)) &&
+		bytes.IndexByte([]byte(" \t\r\n"), in.text[offset]) >= 0 {
+		offset++
+	}
+	if e, ok := err.(*xml.SyntaxError); ok {
+		// right where the decoder stops
+		offset = in.InputOffset()
+		err = fmt.Errorf("malformed XML, %s", e.Msg)
+	}
+	line, col := in.position(offset)
+	return &PosError{in.name, line, col, msg, err}
+}
+
+// elementError makes a PosError of err at the element whose start tag
+// ends at the offset, as the UnmarshalXML methods record it
+func (in *xmlInput) elementError(end int64, msg string, err error) *PosError {
+	// there is no < within a start tag
+	return in.errorAt(int64(bytes.LastIndexByte(in.text[:end], '<')), msg, err)
+}
+
+// position tells the line and column of the offset
+func (in *xmlInput) position(offset int64) (int, int) {
+	before := in.text[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := utf8.RuneCount(before[bytes.LastIndexByte(before, '\n')+1:]) + 1
+	return line, col
+}
+
+// element tells the name of the element starting at the offset of the
+// text, and where it ends, after the "/>" of its start tag, or else after
+// its end tag, at the same depth. The text might not be well-formed, so it
+// is scanned as is. The end is -1 if not found. With no element there, it
+// is the Items around that fail
+func element(text []byte, start int64) (string, int64) {
+	tag := func(i int64, name string) bool {
+		rest := text[i:]
+		if !bytes.HasPrefix(rest, []byte(name)) || len(rest) == len(name) {
+			return false
+		}
+		return bytes.IndexByte([]byte(" \t\r\n/>"), rest[len(name)]) >= 0
+	}
+	// tagEnd is after the ">" of the tag at the offset, quotes skipped
+	tagEnd := func(i int64) int64 {
+		var quote byte
+		for ; i < int64(len(text)); i++ {
+			switch c := text[i]; {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case c == '"' || c == '\'':
+				quote = c
+			case c == '>':
+				return i + 1
+			}
+		}
+		return -1
+	}
+
+	if start >= int64(len(text)) || text[start] != '<' {
+		return "Items", -1
+	}
+	n := start + 1
+	for n < int64(len(text)) && bytes.IndexByte([]byte(" \t\r\n/>"), text[n]) < 0 {
+		n++
+	}
+	name := string(text[start+1 : n])
+	if len(name) == 0 || strings.ContainsAny(name[:1], "/!?") {
+		return "Items", -1
+	}
+	end := tagEnd(start)
+	if end < 0 || text[end-2] == '/' {
+		return name, end
+	}
+	for depth, i := 1, end; i < int64(len(text)); {
+		j := bytes.IndexByte(text[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += int64(j)
+		switch {
+		case tag(i, "</"+name):
+			if i = tagEnd(i); i < 0 {
+				return name, -1
+			}
+			if depth--; depth == 0 {
+				return name, i
+			}
+		case tag(i, "<"+name):
+			k := tagEnd(i)
+			if k < 0 {
+				return name, -1
+			}
+			if text[k-2] != '/' {
+				depth++
+			}
+			i = k
+		default:
+			i++
+		}
+	}
+	return name, -1
+}
+
+// sortErrors puts the errors in the order of their positions
+func sortErrors(errs ErrorList) {
+	pos := func(err error) (int, int) {
+		if e, ok := err.(*PosError); ok {
+			return e.Line, e.Col
+		}
+		return 0, 0
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		li, ci := pos(errs[i])
+		lj, cj := pos(errs[j])
+		return li < lj || li == lj && ci < cj
+	})
+}
+
+func utf16ToUtf8(content []byte, order binary.ByteOrder) []byte {
+	u16s := make([]uint16, len(content)/2)
+	for i := range u16s {
+		u16s[i] = order.Uint16(content[i*2:])
+	}
+	return []byte(string(utf16.Decode(u16s)))
+}
+
+// Encode writes the WebTest model out as a .webtest document
+func (wt *WebTest) Encode(w io.Writer) error {
+	nodes, err := encodeXmlNodes(xml.Name{Local: "WebTest"}, wt)
+	if err != nil {
+		return err
+	}
+	return writeXmlNodes(w, nodes)
+}
+
+// encodeXmlNodes encodes the values as the named elements, into the
+// generic element tree, without the empty list containers
+func encodeXmlNodes(name xml.Name, values ...interface{}) ([]*xmlNode, error) {
+	var buf bytes.Buffer
+	e := xml.NewEncoder(&buf)
+	for _, v := range values {
+		if err := e.EncodeElement(v, xml.StartElement{Name: name}); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+	nodes, err := readXmlNodes(xml.NewDecoder(&buf))
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		n.dropEmpty(wtListElems)
+	}
+	return nodes, nil
+}
+
+// writeXmlNodes writes the nodes to w as a XML document in the Visual
+// Studio layout
+func writeXmlNodes(w io.Writer, nodes []*xmlNode) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(wtXmlHeader + "\r\n")
+	for _, n := range nodes {
+		n.write(bw, "  ", "\r\n", 0)
+	}
+	return bw.Flush()
+}
+
+// InlineXml renders v as XML the way it shows in the .webtest file, but
+// all on one line. It is what the dump uses to show rule parameters etc.
+func InlineXml(v interface{}) string {
+	b, err := xml.Marshal(v)
+	if err != nil || len(b) == 0 {
+		return ""
+	}
+	nodes, err := readXmlNodes(xml.NewDecoder(bytes.NewReader(b)))
+	if err != nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	for _, n := range nodes {
+		n.write(bw, "", "", 0)
+	}
+	bw.Flush()
+	return buf.String()
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Items handling, which keeps the mixed children in order
+
+// UnmarshalXML decodes the items in order. The error of an item tells
+// where the innermost failing item starts, to leave it out in
+// --keep-going mode, see parseInput
+func (items *Items) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	failed := func(at int64, err error) error {
+		if _, ok := err.(*itemError); ok {
+			return err
+		}
+		return &itemError{at, err}
+	}
+	for {
+		// the tokens before, white spaces included, are read already
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err != nil {
+			return failed(offset, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			var item Item
+			switch t.Name.Local {
+			case "Comment":
+				item = &Comment{}
+			case "Request":
+				item = &Request{}
+			case "TransactionTimer":
+				item = &TransactionTimer{}
+			case "Condition":
+				item = &Condition{}
+			case "Loop":
+				item = &Loop{}
+			case "IncludedWebTest":
+				item = &IncludedWebTest{}
+			default:
+				item = &Node{}
+			}
+			if err := d.DecodeElement(item, &t); err != nil {
+				return failed(offset, err)
+			}
+			*items = append(*items, item)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// UnmarshalXML decodes the request, remembering where its start tag ends,
+// for the positions of the check findings and the dump errors
+func (r *Request) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	// without the UnmarshalXML method
+	type request Request
+	r.offset = d.InputOffset()
+	return d.DecodeElement((*request)(r), &start)
+}
+
+func (t *TransactionTimer) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type transactionTimer TransactionTimer
+	t.offset = d.InputOffset()
+	return d.DecodeElement((*transactionTimer)(t), &start)
+}
+
+func (n *Node) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type node Node
+	n.offset = d.InputOffset()
+	return d.DecodeElement((*node)(n), &start)
+}
+
+func (items Items) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, item := range items {
+		err := e.EncodeElement(item,
+			xml.StartElement{Name: xml.Name{Local: item.itemName()}})
+		if err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// Walk calls fn on every request within the items, nested ones included,
+// with the path of the transactions the request is in, outer/inner
+func (items Items) Walk(trans string, fn func(r *Request, trans string)) {
+	for _, item := range items {
+		switch t := item.(type) {
+		case *Request:
+			fn(t, trans)
+		case *TransactionTimer:
+			if len(trans) != 0 {
+				t.Items.Walk(trans+"/"+t.Name, fn)
+			} else {
+				t.Items.Walk(t.Name, fn)
+			}
+		case *Loop:
+			t.Items.Walk(trans, fn)
+		case *Condition:
+			if t.Then != nil {
+				t.Then.Items.Walk(trans, fn)
+			}
+			if t.Else != nil {
+				t.Else.Items.Walk(trans, fn)
+			}
+		}
+	}
+}
+
+// MarshalXML writes the Node back out, without the namespace it was read in
+func (n Node) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Local: n.XMLName.Local}, Attr: n.Attrs}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	d := xml.NewDecoder(strings.NewReader(n.Inner))
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := e.EncodeToken(xml.CopyToken(token)); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Generic element tree
+
+// readXmlNodes reads all the top-level elements from the decoder
+func readXmlNodes(d *xml.Decoder) ([]*xmlNode, error) {
+	var nodes []*xmlNode
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nodes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := token.(xml.StartElement); ok {
+			n, err := readXmlNode(d, t)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		}
+	}
+}
+
+func readXmlNode(d *xml.Decoder, start xml.StartElement) (*xmlNode, error) {
+	n := &xmlNode{name: start.Name.Local}
+	for _, a := range start.Attr {
+		if a.Name.Space == "xmlns" {
+			a.Name.Local = "xmlns:" + a.Name.Local
+		}
+		n.attr = append(n.attr, xml.Attr{Name: xml.Name{Local: a.Name.Local}, Value: a.Value})
+	}
+	var text bytes.Buffer
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			c, err := readXmlNode(d, t)
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, c)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			// whitespaces between child elements are only indentation
+			if len(n.children) == 0 || len(bytes.TrimSpace(text.Bytes())) != 0 {
+				n.text = text.String()
+			}
+			return n, nil
+		}
+	}
+}
+
+// dropEmpty removes the named child elements that have nothing in them
+func (n *xmlNode) dropEmpty(names map[string]bool) {
+	children := n.children[:0]
+	for _, c := range n.children {
+		c.dropEmpty(names)
+		if names[c.name] && len(c.children) == 0 && len(c.attr) == 0 &&
+			len(c.text) == 0 {
+			continue
+		}
+		children = append(children, c)
+	}
+	n.children = children
+}
+
+func (n *xmlNode) write(w *bufio.Writer, indent, eol string, depth int) {
+	if n.conflict != nil {
+		n.writeConflict(w, indent, eol, depth)
+		return
+	}
+	pad := strings.Repeat(indent, depth)
+	switch {
+	case len(n.children) == 0 && len(n.text) == 0:
+		w.WriteString(pad + n.startTag(n.attr) + " />" + eol)
+	case len(n.children) == 0:
+		w.WriteString(pad + n.startTag(n.attr) + ">" +
+			xmlTextEscaper.Replace(n.text) + "</" + n.name + ">" + eol)
+	default:
+		if n.theirs != nil {
+			w.WriteString(mergeOurs + eol + pad + n.startTag(n.attr) + ">" + eol +
+				mergeSep + eol + pad + n.startTag(n.theirs) + ">" + eol +
+				mergeTheirs + eol)
+		} else {
+			w.WriteString(pad + n.startTag(n.attr) + ">" + eol)
+		}
+		for _, c := range n.children {
+			c.write(w, indent, eol, depth+1)
+		}
+		w.WriteString(pad + "</" + n.name + ">" + eol)
+	}
+}
+
+// startTag is the start tag of the node with the attributes, unclosed
+func (n *xmlNode) startTag(attr []xml.Attr) string {
+	var b bytes.Buffer
+	b.WriteString("<" + n.name)
+	for _, a := range attr {
+		b.WriteString(" " + a.Name.Local + `="` + xmlAttrEscaper.Replace(a.Value) + `"`)
+	}
+	return b.String()
+}
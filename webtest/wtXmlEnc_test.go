@@ -0,0 +1,123 @@
+package webtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// readSample reads the sample web test, which is in the Visual Studio
+// layout, so round-trips byte for byte
+func readSample(t *testing.T) []byte {
+	content, err := ioutil.ReadFile("testdata/sample.webtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+// toUtf16 saves the content the way Visual Studio does in Unicode
+func toUtf16(content []byte, order binary.ByteOrder, bom bool) []byte {
+	text := strings.Replace(string(content),
+		`encoding="utf-8"`, `encoding="utf-16"`, 1)
+	var buf bytes.Buffer
+	if bom {
+		binary.Write(&buf, order, uint16(0xFEFF))
+	}
+	for _, u := range utf16.Encode([]rune(text)) {
+		binary.Write(&buf, order, u)
+	}
+	return buf.Bytes()
+}
+
+func encodeString(t *testing.T, content []byte) string {
+	wt, err := Parse(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := wt.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestParseEncode(t *testing.T) {
+	sample := readSample(t)
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"as is", sample},
+		{"UTF-8 BOM", append([]byte{0xEF, 0xBB, 0xBF}, sample...)},
+		{"UTF-16LE", toUtf16(sample, binary.LittleEndian, true)},
+		{"UTF-16BE", toUtf16(sample, binary.BigEndian, true)},
+		{"UTF-16LE without BOM", toUtf16(sample, binary.LittleEndian, false)},
+		{"LF line endings", bytes.Replace(sample, []byte("\r\n"), []byte("\n"), -1)},
+	}
+	for _, tt := range tests {
+		if got := encodeString(t, tt.content); got != string(sample) {
+			t.Errorf("%s: got\n%s", tt.name, got)
+		}
+	}
+}
+
+func TestParseUnknown(t *testing.T) {
+	source := wtXmlHeader + "\r\n" +
+		`<WebTest Name="A" Owner="" Priority="0" Enabled="True" CssProjectStructure="" CssIteration="" Timeout="0" WorkItemIds="" Description="" CredentialUserName="" CredentialPassword="" PreAuthenticate="True" Proxy="default" StopOnError="False" ResultsLocale="" New="1">` + "\r\n" +
+		"  <Items>\r\n" +
+		`    <Request Method="GET" Guid="g1" Version="1.1" Url="http://a/" ThinkTime="0" Timeout="300" ParseDependentRequests="True" FollowRedirects="True" RecordResult="True" Cache="False" ResponseTimeGoal="0" Encoding="utf-8" ExpectedHttpStatusCode="0" ExpectedResponseUrl="" ReportingName="" IgnoreHttpStatusCode="False" Extra="x &amp; y">` + "\r\n" +
+		"      <Future Kind=\"b\">\r\n" +
+		"        <Inner />\r\n" +
+		"      </Future>\r\n" +
+		"    </Request>\r\n" +
+		"    <Pause Seconds=\"3\" />\r\n" +
+		`    <Comment CommentText="c" />` + "\r\n" +
+		"  </Items>\r\n" +
+		"  <Reports Kind=\"x\" />\r\n" +
+		"</WebTest>\r\n"
+	if got := encodeString(t, []byte(source)); got != source {
+		t.Errorf("got\n%s\nwant\n%s", got, source)
+	}
+}
+
+func TestParseItems(t *testing.T) {
+	wt, err := Parse(bytes.NewReader(readSample(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, item := range wt.Items {
+		names = append(names, item.itemName())
+	}
+	want := "Comment TransactionTimer Loop IncludedWebTest TransactionTimer"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("items %s, want %s", got, want)
+	}
+	r := wt.Items[1].(*TransactionTimer).Items[0].(*Request)
+	if len(r.DependentRequests) != 1 || len(r.QueryStringParameters) != 2 ||
+		r.Headers[0].Value != `Bearer abc"def` {
+		t.Errorf("request not decoded: %+v", r)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"", "1:1: reading the web test: no root element"},
+		{wtXmlHeader + "\r\n<Project />", "2:1: reading the web test: not a web test"},
+		{wtXmlHeader + "\r\n<WebTest>\r\n  <Items>\r\n    <Comment>\r\n  </Items>",
+			"5:11: bad <Comment> element: malformed XML, element <Comment> closed by </Items>"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(strings.NewReader(tt.source))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%q: error %v, want %q", tt.source, err, tt.err)
+		}
+	}
+}
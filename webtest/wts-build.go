@@ -0,0 +1,766 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-build
+// Purpose: wts (web test script) build handling, .webtext => .webtest
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+const (
+	wtNamespace = "http://microsoft.com/schemas/VisualStudio/TeamTest/2010"
+	wtRulesNS   = "Microsoft.VisualStudio.TestTools.WebTesting.Rules."
+	wtFramework = ", Microsoft.VisualStudio.QualityTools.WebTestFramework, Version=10.0.0.0, Culture=neutral, PublicKeyToken=b03f5f7f11d50a3a"
+)
+
+// stockRules maps the DisplayName of the stock Visual Studio rules, the
+// only thing the .webtext shows, back to their Classname
+var stockRules = map[string]string{
+	// ConditionalRule
+	"Number Comparison":        "NumericalComparisonRule",
+	"String Comparison":        "StringComparisonRule",
+	"Context Parameter Exists": "ContextParameterExistenceRule",
+	"Cookie Exists":            "CookieExistenceRule",
+	"Probability":              "ProbabilityRule",
+	"For Loop":                 "ForLoopRule",
+	"Counting Loop":            "CountingLoopRule",
+	// ExtractionRule
+	"Extract Attribute Value":    "ExtractAttributeValue",
+	"Extract Form Field":         "ExtractFormField",
+	"Extract HTTP Header":        "ExtractHttpHeader",
+	"Extract Regular Expression": "ExtractRegularExpression",
+	"Extract Text":               "ExtractText",
+	"Extract Hidden Fields":      "ExtractHiddenFields",
+	"Extract Selected Option":    "ExtractSelectedOption",
+	"Extract Tag Inner Text":     "ExtractTagInnerText",
+	// ValidationRule
+	"Response URL":             "ValidateResponseUrl",
+	"Response Time Goal":       "ValidationRuleResponseTimeGoal",
+	"Find Text":                "ValidationRuleFindText",
+	"Form Field":               "ValidateFormField",
+	"Maximum Request Time":     "ValidateRequestTime",
+	"Required Attribute Value": "ValidationRuleRequiredAttributeValue",
+	"Required Tag":             "ValidationRuleRequiredTag",
+	"Selected Option":          "ValidationRuleSelectedOption",
+	"Tag Inner Text":           "ValidationRuleInnerText",
+}
+
+// BuildOptions tells how to build a web test out of its .webtext
+type BuildOptions struct {
+	// Name is the web test name, unless the WT: line tells
+	Name string
+	// Base is the web test to take the WebTest settings, the rule class
+	// names, the request Guids and the Loop and Condition ids from
+	Base *WebTest
+}
+
+// buildLevel is one level of TransactionTimer/Loop/Condition nesting
+// while building, by the tag that opens it, T, LP or CB
+type buildLevel struct {
+	tag   string
+	items *Items     // where the items go
+	cond  *Condition // for EL: to switch to the Else branch
+}
+
+// ruleInfo is what the .webtext does not show of a rule, by its
+// DisplayName, the Classname, and the rest learned from the base web test
+type ruleInfo struct {
+	class       string
+	description string
+	level       string // of the validation rules
+	order       string // ExectuionOrder, of the validation rules
+	attrs       []xml.Attr
+}
+
+// blockInfo is what the .webtext does not show of a Loop or Condition of
+// the base web test
+type blockInfo struct {
+	id    string
+	attrs []xml.Attr
+	rule  ConditionalRule // without the RuleParameters
+}
+
+// builder holds the state of parsing the .webtext
+type builder struct {
+	wt      *WebTest
+	levels  []buildLevel
+	req     *Request
+	body    []string // the "  |" lines of the StringBody of req
+	bodyEol string
+	pending bool // a "<=" is seen, LP: or CB: should follow
+	rules   map[string]ruleInfo
+	guids   map[string][]string    // of the base requests, by method and url
+	blocks  map[string][]blockInfo // of the base Loops and Conditions, by tag and rule
+	dep     *builder               // for the "  D: " lines of the dependent requests of req
+}
+
+var (
+	buildReqRe  = regexp.MustCompile(`^([GP]|M: \S+):? \((\d*),(\d*)\) (\S*) ?(.*?) \((.*)\):(\w*)$`)
+	buildRuleRe = regexp.MustCompile(`^\((.*?)\) ?(.*)$`)
+	buildExtRe  = regexp.MustCompile(`^\((.*?): (.*?)\) ?(.*)$`)
+	buildDSRe   = regexp.MustCompile(`^\((.*?), (.*)\) ?(.*)$`)
+	buildAddOn  = regexp.MustCompile(`^  [A-Z]: `)
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// Build builds the web test out of its .webtext, the text dump with
+// --asis, the other way round
+func Build(r io.Reader, opt BuildOptions) (*WebTest, error) {
+	b := newBuilder(opt.Name)
+	if opt.Base != nil {
+		b.useBase(opt.Base)
+	}
+	if err := b.parse(r); err != nil {
+		return nil, err
+	}
+	return b.wt, nil
+}
+
+// newBuilder starts a new web test of the name, with the settings Visual
+// Studio gives to a new web test
+func newBuilder(name string) *builder {
+	wt := &WebTest{
+		Name:            name,
+		Id:              newGuid(),
+		Priority:        "2147483647",
+		Enabled:         "True",
+		Timeout:         "0",
+		Xmlns:           wtNamespace,
+		PreAuthenticate: "True",
+		Proxy:           "default",
+		StopOnError:     "False",
+	}
+	b := &builder{wt: wt, rules: map[string]ruleInfo{},
+		guids: map[string][]string{}, blocks: map[string][]blockInfo{}}
+	b.levels = []buildLevel{{items: &wt.Items}}
+	for k, v := range stockRules {
+		b.rules[k] = ruleInfo{class: wtRulesNS + v + wtFramework}
+	}
+	return b
+}
+
+// useBase takes the WebTest settings and plugins from the base web test,
+// and learns what the .webtext does not show of the rules, the requests,
+// the Loops and Conditions used in it
+func (b *builder) useBase(base *WebTest) {
+	wt := *base
+	wt.Items = b.wt.Items
+	// those are all in the .webtext
+	wt.DataSources, wt.ContextParameters, wt.ValidationRules = nil, nil, nil
+	wt.WebTestPlugins = nil
+	wt.Unknown = nil
+	*b.wt = wt
+	for _, v := range base.ValidationRules {
+		b.rules[v.DisplayName] = ruleInfo{v.Classname, v.Description,
+			v.Level, v.ExectuionOrder, v.Attrs}
+	}
+	for _, v := range base.WebTestPlugins {
+		b.learnPlugin(v.Plugin)
+	}
+	var request func(r *Request)
+	request = func(r *Request) {
+		key := r.Method + " " + r.Url
+		b.guids[key] = append(b.guids[key], r.Guid)
+		for _, v := range r.RequestPlugins {
+			b.learnPlugin(v.Plugin)
+		}
+		for _, v := range r.ExtractionRules {
+			b.rules[v.DisplayName] = ruleInfo{class: v.Classname,
+				description: v.Description, attrs: v.Attrs}
+		}
+		for _, v := range r.ValidationRules {
+			b.rules[v.DisplayName] = ruleInfo{v.Classname, v.Description,
+				v.Level, v.ExectuionOrder, v.Attrs}
+		}
+		for _, d := range r.DependentRequests {
+			request(d)
+		}
+	}
+	var learn func(items Items)
+	learn = func(items Items) {
+		for _, item := range items {
+			switch t := item.(type) {
+			case *Request:
+				request(t)
+			case *TransactionTimer:
+				learn(t.Items)
+			case *Loop:
+				b.learnBlock("LP", t.UniqueStringId, t.Attrs, t.ConditionalRule)
+				learn(t.Items)
+			case *Condition:
+				b.learnBlock("CB", t.UniqueStringId, t.Attrs, t.ConditionalRule)
+				if t.Then != nil {
+					learn(t.Then.Items)
+				}
+				if t.Else != nil {
+					learn(t.Else.Items)
+				}
+			}
+		}
+	}
+	learn(base.Items)
+}
+
+func (b *builder) learnPlugin(p Plugin) {
+	b.rules[p.DisplayName] = ruleInfo{class: p.Classname,
+		description: p.Description, attrs: p.Attrs}
+}
+
+// learnBlock learns the Loop or Condition, by the tag that opens it, LP
+// or CB, and its rule
+func (b *builder) learnBlock(tag, id string, attrs []xml.Attr,
+	rule *ConditionalRule) {
+	if rule == nil {
+		return
+	}
+	b.rules[rule.DisplayName] = ruleInfo{class: rule.Classname,
+		description: rule.Description, attrs: rule.Attrs}
+	r := *rule
+	r.RuleParameters = nil
+	key := tag + " " + rule.DisplayName
+	b.blocks[key] = append(b.blocks[key], blockInfo{id, attrs, r})
+}
+
+// parse reads the .webtext lines, in the format that treatWtsXml,
+// treatRequest and dealReqAddons write them
+func (b *builder) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	lineNo := 1
+	for ; scanner.Scan(); lineNo++ {
+		// a CR left is of the StringBody, the CRLF are taken by the scanner
+		if err := b.parseLine(scanner.Text()); err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := b.endRequest(); err != nil {
+		return fmt.Errorf("line %d: %v", lineNo, err)
+	}
+	if n := len(b.levels); n > 1 {
+		return fmt.Errorf("%s: block is not closed", b.levels[n-1].tag)
+	}
+	return nil
+}
+
+func (b *builder) parseLine(line string) error {
+	// the lines are indented by the nesting depth, but for the end markers
+	// of the innermost block, which are one level out
+	indent := strings.Repeat("  ", len(b.levels)-1)
+	if strings.HasPrefix(line, indent) {
+		line = line[len(indent):]
+	} else {
+		line = strings.TrimLeft(line, " ")
+	}
+	if strings.HasPrefix(line, "  |") {
+		if b.req == nil {
+			return fmt.Errorf("StringBody line out of a request: %s", line)
+		}
+		// verbatim, but for the one space after the "|"
+		line = strings.TrimPrefix(line[3:], " ")
+		b.body = append(b.body, line)
+		return nil
+	}
+	line = strings.TrimRight(line, "\r")
+	if b.pending && !strings.HasPrefix(line, "LP: ") &&
+		!strings.HasPrefix(line, "CB: ") {
+		return fmt.Errorf("LP: or CB: expected after <=")
+	}
+
+	if len(line) == 0 {
+		return b.endRequest()
+	}
+	if buildAddOn.MatchString(line) {
+		if b.req == nil {
+			return fmt.Errorf("addon line out of a request: %s", line)
+		}
+		return b.addOn(line[2:3], line[5:])
+	}
+
+	tag, v := line, ""
+	if i := strings.Index(line, ": "); i > 0 {
+		tag, v = line[:i], line[i+2:]
+	}
+	tag = strings.TrimSuffix(tag, ":")
+	switch tag {
+	case "C":
+		b.add(&Comment{CommentText: v})
+	case "T":
+		tt := &TransactionTimer{Name: v}
+		b.add(tt)
+		b.levels = append(b.levels, buildLevel{tag: tag, items: &tt.Items})
+	case "TE":
+		if err := b.end("T"); err != nil {
+			return err
+		}
+	case "G", "P", "M":
+		return b.request(line)
+	case "I":
+		it := &IncludedWebTest{}
+		if !strings.HasPrefix(v, "<") {
+			// only the name, as dumped before the whole element is shown
+			it.Name, it.Path = v, v+".webtest"
+		} else if err := xml.Unmarshal([]byte(v), it); err != nil {
+			return fmt.Errorf("bad I: line: %v", err)
+		}
+		b.add(it)
+	case "<=":
+		b.pending = true
+	case "LP", "CB":
+		if !b.pending {
+			// the LP:/CE: before => at the end of the block
+			return nil
+		}
+		b.pending = false
+		m := buildRuleRe.FindStringSubmatch(v)
+		if m == nil {
+			return fmt.Errorf("bad %s: line: %s", tag, v)
+		}
+		id, attrs, rule, err := b.block(tag, m[1])
+		if err != nil {
+			return err
+		}
+		if err := unmarshalInline(m[2], &rule.RuleParameters); err != nil {
+			return err
+		}
+		if tag == "LP" {
+			lp := &Loop{UniqueStringId: id, Attrs: attrs,
+				ConditionalRule: rule}
+			b.add(lp)
+			b.levels = append(b.levels, buildLevel{tag: tag, items: &lp.Items})
+		} else {
+			cb := &Condition{UniqueStringId: id, Attrs: attrs,
+				ConditionalRule: rule, Then: &Branch{},
+				Else: &Branch{}}
+			b.add(cb)
+			b.levels = append(b.levels,
+				buildLevel{tag: tag, items: &cb.Then.Items, cond: cb})
+		}
+	case "EL":
+		level := &b.levels[len(b.levels)-1]
+		if level.cond == nil {
+			return fmt.Errorf("EL: out of a CB: block")
+		}
+		level.items = &level.cond.Else.Items
+	case "CE":
+	case "=>":
+		if tag := b.levels[len(b.levels)-1].tag; tag != "LP" && tag != "CB" {
+			return fmt.Errorf("=> without matching <=")
+		}
+		b.end(b.levels[len(b.levels)-1].tag)
+	case "CP":
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("bad CP: line: %s", v)
+		}
+		b.wt.ContextParameters = append(b.wt.ContextParameters,
+			ContextParameter{Name: kv[0], Value: kv[1]})
+	case "DS":
+		m := buildDSRe.FindStringSubmatch(v)
+		if m == nil {
+			return fmt.Errorf("bad DS: line: %s", v)
+		}
+		ds := DataSource{Name: m[1], Connection: m[2], Provider: dsProvider(m[2])}
+		if err := unmarshalInline(m[3], &ds.Tables); err != nil {
+			return err
+		}
+		b.wt.DataSources = append(b.wt.DataSources, ds)
+	case "VR":
+		m := buildRuleRe.FindStringSubmatch(v)
+		if m == nil {
+			return fmt.Errorf("bad VR: line: %s", v)
+		}
+		vr, err := b.validationRule(m[1])
+		if err != nil {
+			return err
+		}
+		if err := unmarshalInline(m[2], &vr.RuleParameters); err != nil {
+			return err
+		}
+		b.wt.ValidationRules = append(b.wt.ValidationRules, vr)
+	case "WT":
+		var s Settings
+		if err := xml.Unmarshal([]byte(v), &s); err != nil {
+			return fmt.Errorf("bad WT: line: %v", err)
+		}
+		return b.useSettings(s)
+	case "WP":
+		m := buildRuleRe.FindStringSubmatch(v)
+		if m == nil {
+			return fmt.Errorf("bad WP: line: %s", v)
+		}
+		plugin, err := b.plugin(m[1])
+		if err != nil {
+			return err
+		}
+		p := WebTestPlugin{Plugin: plugin}
+		if err := unmarshalInline(m[2], &p.RuleParameters); err != nil {
+			return err
+		}
+		b.wt.WebTestPlugins = append(b.wt.WebTestPlugins, p)
+	case "TS":
+		// the time string summary from --tsr, nothing to build
+	default:
+		return fmt.Errorf("unrecognized line: %s", line)
+	}
+	return nil
+}
+
+// useSettings takes the WebTest settings of the WT: line. A masked
+// CredentialPassword can only be taken from the base web test
+func (b *builder) useSettings(s Settings) error {
+	wt := b.wt
+	if len(s.Name) != 0 {
+		wt.Name = s.Name
+	}
+	wt.Owner, wt.Priority, wt.Enabled = s.Owner, s.Priority, s.Enabled
+	wt.Description, wt.CredentialUserName = s.Description, s.CredentialUserName
+	wt.PreAuthenticate, wt.Proxy, wt.StopOnError =
+		s.PreAuthenticate, s.Proxy, s.StopOnError
+	if s.CredentialPassword != SecretMask {
+		wt.CredentialPassword = s.CredentialPassword
+	} else if len(wt.CredentialPassword) == 0 {
+		return fmt.Errorf("the CredentialPassword is masked, " +
+			"give the --base web test to take it from")
+	}
+	return nil
+}
+
+// add appends the item to the innermost open Items
+func (b *builder) add(item Item) {
+	level := b.levels[len(b.levels)-1]
+	*level.items = append(*level.items, item)
+}
+
+// end closes the innermost block, which should be opened by the tag
+func (b *builder) end(tag string) error {
+	n := len(b.levels)
+	if n == 1 || b.levels[n-1].tag != tag {
+		return fmt.Errorf("end of %s: without matching begin", tag)
+	}
+	b.levels = b.levels[:n-1]
+	return nil
+}
+
+// request parses the G:, P: and M: lines, e.g.,
+//
+//	G: (0,300) {{web}}Account/LogOn (Logon):True
+//	P: (0,300) {{web}}Service.svc Get.Svc.Method ():True
+//	M: PUT (0,300) {{web}}api/orders/1  ():True
+//
+// The other attributes are the Visual Studio defaults, but for the ones
+// on the "  A: " line, and the Guid is of the same request in the base
+// web test, if any
+func (b *builder) request(line string) error {
+	m := buildReqRe.FindStringSubmatch(line)
+	if m == nil {
+		return fmt.Errorf("bad request line: %s", line)
+	}
+	if err := b.endRequest(); err != nil {
+		return err
+	}
+	r := NewRequest()
+	r.Url, r.ThinkTime, r.Timeout = m[4], m[2], m[3]
+	r.ReportingName, r.RecordResult = m[6], m[7]
+	switch m[1] {
+	case "G":
+	case "P":
+		r.Method = "POST"
+	default:
+		r.Method = strings.TrimPrefix(m[1], "M: ")
+	}
+	key := r.Method + " " + r.Url
+	if guids := b.guids[key]; len(guids) != 0 {
+		r.Guid, b.guids[key] = guids[0], guids[1:]
+	} else {
+		r.Guid = newGuid()
+	}
+	b.add(r)
+	b.req = r
+	return nil
+}
+
+// endRequest finishes the request being built, if any
+func (b *builder) endRequest() error {
+	if b.req == nil {
+		return nil
+	}
+	if err := b.endBody(); err != nil {
+		return err
+	}
+	if err := b.endDeps(); err != nil {
+		return err
+	}
+	b.req = nil
+	return nil
+}
+
+// endBody turns the collected StringBody lines into the StringHttpBody,
+// joined with the line ending the S: line tells
+func (b *builder) endBody() error {
+	r := b.req
+	if b.body == nil {
+		if r.StringHttpBody != nil {
+			return fmt.Errorf("S: line without StringBody lines")
+		}
+		return nil
+	}
+	eol := b.bodyEol
+	if len(eol) == 0 {
+		eol = "\r\n"
+	}
+	body := strings.Join(b.body, eol)
+	if r.StringHttpBody == nil {
+		r.StringHttpBody = &StringHttpBody{
+			ContentType: bodyContentType(body), InsertByteOrderMark: "False"}
+	}
+	r.StringHttpBody.Body = EncodeStringBody(body)
+	b.body, b.bodyEol = nil, ""
+	return nil
+}
+
+// endDeps turns the requests built out of the "  D: " lines into the
+// DependentRequests of the request they follow
+func (b *builder) endDeps() error {
+	if b.dep == nil {
+		return nil
+	}
+	if err := b.dep.endRequest(); err != nil {
+		return err
+	}
+	for _, item := range b.dep.wt.Items {
+		if r, ok := item.(*Request); ok {
+			b.req.DependentRequests = append(b.req.DependentRequests, r)
+		}
+	}
+	b.dep = nil
+	return nil
+}
+
+// addOn parses the request addon lines that dealReqAddons writes, and the
+// "  D: " lines of the dependent requests that dealOneRequest writes
+func (b *builder) addOn(tag, v string) error {
+	r := b.req
+	switch tag {
+	case "D":
+		if b.dep == nil {
+			b.dep = &builder{wt: &WebTest{}, rules: b.rules,
+				guids: b.guids, blocks: b.blocks}
+			b.dep.levels = []buildLevel{{items: &b.dep.wt.Items}}
+		}
+		return b.dep.parseLine(v)
+	case "S":
+		m := buildRuleRe.FindStringSubmatch(v)
+		if m == nil {
+			return fmt.Errorf("bad S: line: %s", v)
+		}
+		r.StringHttpBody = &StringHttpBody{
+			ContentType: m[1], InsertByteOrderMark: "False"}
+		for _, tag := range strings.Fields(m[2]) {
+			switch tag {
+			case "BOM":
+				r.StringHttpBody.InsertByteOrderMark = "True"
+			case "LF":
+				b.bodyEol = "\n"
+			case "decoded":
+				return fmt.Errorf("the StringBody is shown XML decoded, " +
+					"dump with --asis to build it back")
+			default:
+				return fmt.Errorf("bad S: line: %s", v)
+			}
+		}
+	case "A":
+		if err := xml.Unmarshal([]byte("<Request "+v+" />"), r); err != nil {
+			return fmt.Errorf("bad A: line '%s': %v", v, err)
+		}
+	case "B":
+		m := buildRuleRe.FindStringSubmatch(v)
+		if m == nil {
+			return fmt.Errorf("bad B: line: %s", v)
+		}
+		r.BinaryHttpBody = &BinaryHttpBody{ContentType: m[1], Data: m[2]}
+	case "H":
+		return unmarshalInline(v, &r.Headers)
+	case "Q":
+		return unmarshalInline(v, &r.QueryStringParameters)
+	case "F":
+		r.FormPostHttpBody = &FormPostHttpBody{}
+		return unmarshalInline(v, r.FormPostHttpBody)
+	case "R":
+		m := buildRuleRe.FindStringSubmatch(v)
+		if m == nil {
+			return fmt.Errorf("bad R: line: %s", v)
+		}
+		plugin, err := b.plugin(m[1])
+		if err != nil {
+			return err
+		}
+		p := RequestPlugin{Plugin: plugin}
+		if err := unmarshalInline(m[2], &p.RuleParameters); err != nil {
+			return err
+		}
+		r.RequestPlugins = append(r.RequestPlugins, p)
+	case "E":
+		m := buildExtRe.FindStringSubmatch(v)
+		if m == nil {
+			return fmt.Errorf("bad E: line: %s", v)
+		}
+		info, err := b.rule(m[1])
+		if err != nil {
+			return err
+		}
+		e := ExtractionRule{Classname: info.class, VariableName: m[2],
+			DisplayName: m[1], Description: info.description, Attrs: info.attrs}
+		if err := unmarshalInline(m[3], &e.RuleParameters); err != nil {
+			return err
+		}
+		r.ExtractionRules = append(r.ExtractionRules, e)
+	case "V":
+		m := buildRuleRe.FindStringSubmatch(v)
+		if m == nil {
+			return fmt.Errorf("bad V: line: %s", v)
+		}
+		vr, err := b.validationRule(m[1])
+		if err != nil {
+			return err
+		}
+		if err := unmarshalInline(m[2], &vr.RuleParameters); err != nil {
+			return err
+		}
+		r.ValidationRules = append(r.ValidationRules, vr)
+	default:
+		return fmt.Errorf("unknown request addon %s:", tag)
+	}
+	return nil
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Support functions
+
+// rule looks up the rule Classname etc. by its DisplayName
+func (b *builder) rule(name string) (ruleInfo, error) {
+	if info, ok := b.rules[name]; ok {
+		return info, nil
+	}
+	return ruleInfo{}, fmt.Errorf("unknown rule class for '%s', "+
+		"give the --base web test to take it from", name)
+}
+
+func (b *builder) validationRule(name string) (ValidationRule, error) {
+	info, err := b.rule(name)
+	return ValidationRule{Classname: info.class, DisplayName: name,
+		Description: info.description, Level: info.level,
+		ExectuionOrder: info.order, Attrs: info.attrs}, err
+}
+
+func (b *builder) plugin(name string) (Plugin, error) {
+	info, err := b.rule(name)
+	return Plugin{Classname: info.class, DisplayName: name,
+		Description: info.description, Attrs: info.attrs}, err
+}
+
+// block makes the UniqueStringId, the attributes and the rule of the Loop,
+// LP, or Condition, CB, of the rule DisplayName. They are of the next one
+// of the same in the base web test, if any, or else a new Guid and the
+// Visual Studio defaults
+func (b *builder) block(tag, name string) (string, []xml.Attr,
+	*ConditionalRule, error) {
+	key := tag + " " + name
+	if blocks := b.blocks[key]; len(blocks) != 0 {
+		b.blocks[key] = blocks[1:]
+		rule := blocks[0].rule
+		return blocks[0].id, blocks[0].attrs, &rule, nil
+	}
+	info, err := b.rule(name)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	rule := &ConditionalRule{Classname: info.class, DisplayName: name,
+		Description: info.description, Attrs: info.attrs}
+	if tag == "LP" {
+		rule.MaxIterations, rule.AdvanceDataCursors = "-1", "False"
+	}
+	return newGuid(), nil, rule, nil
+}
+
+// dsProvider guesses the data source provider from its connection
+func dsProvider(conn string) string {
+	switch strings.ToLower(filepath.Ext(conn)) {
+	case ".csv":
+		return "Microsoft.VisualStudio.TestTools.DataSource.CSV"
+	case ".xml":
+		return "Microsoft.VisualStudio.TestTools.DataSource.XML"
+	}
+	return "System.Data.OleDb"
+}
+
+// bodyContentType guesses the StringHttpBody ContentType from the body
+func bodyContentType(body string) string {
+	switch {
+	case strings.HasPrefix(body, "<"):
+		return "text/xml"
+	case strings.HasPrefix(body, "{") || strings.HasPrefix(body, "["):
+		return "application/json"
+	}
+	return "text/plain"
+}
+
+// unmarshalInline is the reverse of InlineXml, for the slice of elements
+// (or the struct of such slices) pointed to by v
+func unmarshalInline(s string, v interface{}) error {
+	if len(s) == 0 {
+		return nil
+	}
+	var err error
+	switch p := v.(type) {
+	case *[]RuleParameter:
+		var x struct{ RuleParameter []RuleParameter }
+		err = xml.Unmarshal([]byte("<x>"+s+"</x>"), &x)
+		*p = append(*p, x.RuleParameter...)
+	case *[]QueryStringParameter:
+		var x struct {
+			QueryStringParameter []QueryStringParameter
+		}
+		err = xml.Unmarshal([]byte("<x>"+s+"</x>"), &x)
+		*p = append(*p, x.QueryStringParameter...)
+	case *[]Header:
+		var x struct{ Header []Header }
+		err = xml.Unmarshal([]byte("<x>"+s+"</x>"), &x)
+		*p = append(*p, x.Header...)
+	case *[]DataSourceTable:
+		var x struct{ DataSourceTable []DataSourceTable }
+		err = xml.Unmarshal([]byte("<x>"+s+"</x>"), &x)
+		*p = append(*p, x.DataSourceTable...)
+	default:
+		err = xml.Unmarshal([]byte("<x>"+s+"</x>"), v)
+	}
+	if err != nil {
+		return fmt.Errorf("bad XML '%s': %v", s, err)
+	}
+	return nil
+}
+
+func newGuid() string {
+	u := make([]byte, 16)
+	rand.Read(u)
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
@@ -0,0 +1,193 @@
+package webtest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testWebTest makes a .webtest document of the items, with the settings
+// Visual Studio gives to a new web test
+func testWebTest(items string) string {
+	return `<?xml version="1.0" encoding="utf-8"?>
+<WebTest Name="Sample" Id="2a1b5a56-6a36-4d1d-9a1e-5d4e4cbb1a01" Owner="" Priority="2147483647" Enabled="True" CssProjectStructure="" CssIteration="" Timeout="0" WorkItemIds="" xmlns="http://microsoft.com/schemas/VisualStudio/TeamTest/2010" Description="" CredentialUserName="" CredentialPassword="" PreAuthenticate="True" Proxy="default" StopOnError="False" RecordedResultFile="" ResultsLocale="">
+  <Items>
+` + items + `
+  </Items>
+</WebTest>
+`
+}
+
+// testRequest makes a request element with the Visual Studio defaults,
+// but for the attrs given, and with the inner elements
+func testRequest(method, guid, url, attrs, inner string) string {
+	return fmt.Sprintf(`<Request Method="%s" Guid="%s" Version="1.1" Url="%s" ThinkTime="0" Timeout="300" ParseDependentRequests="True" FollowRedirects="True" RecordResult="True" Cache="False" ResponseTimeGoal="0" Encoding="utf-8" ExpectedHttpStatusCode="0" ExpectedResponseUrl="" ReportingName="" IgnoreHttpStatusCode="False" %s>%s</Request>`,
+		method, guid, url, attrs, inner)
+}
+
+func testBody(body string) string {
+	return `<StringHttpBody ContentType="text/xml" InsertByteOrderMark="False">` +
+		EncodeStringBody(body) + `</StringHttpBody>`
+}
+
+// dumpText dumps the web test with the dump options
+func dumpText(t *testing.T, source string, opt DumpOptions) string {
+	dp, err := NewDumper("Sample.webtest", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := dp.Dump(&buf, strings.NewReader(source)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// buildText builds the .webtext, with the base web test if given
+func buildText(text string, base *WebTest) (string, error) {
+	wt, err := Build(strings.NewReader(text), BuildOptions{Name: "Out", Base: base})
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = wt.Encode(&buf)
+	return buf.String(), err
+}
+
+func encodeSource(t *testing.T, source string) string {
+	wt, err := Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := wt.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestBuildRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		items string
+	}{
+		{"body with empty lines", testRequest("POST", "g1", "{{web}}a.svc", "",
+			testBody("<a>\r\n\r\n  <b>1</b>\r\n\r\n</a>\r\n"))},
+		{"body with LF line endings", testRequest("POST", "g1", "{{web}}a.svc", "",
+			testBody("{\n\n  \"a\": 1\n}"))},
+		{"body with mixed line endings", testRequest("POST", "g1", "{{web}}a.svc", "",
+			testBody("a\r\nb\nc\r\r\n"))},
+		{"body of addon-like lines", testRequest("POST", "g1", "{{web}}a.svc", "",
+			testBody("  S: (text/plain)\r\nG: (0,0) x ():True\r\n"))},
+		{"empty body", testRequest("POST", "g1", "{{web}}a.svc", "", testBody(""))},
+		{"attributes not the defaults", testRequest("POST", "g1", "{{web}}a",
+			`MyAttr="x &quot;y&quot;"`, "")},
+		{"attributes missing", `<Request Method="GET" Guid="g1" Version="1.1" Url="{{web}}a" ThinkTime="0" Timeout="300" ParseDependentRequests="False" FollowRedirects="False" RecordResult="True" Cache="True" ResponseTimeGoal="5" Encoding="utf-16" ExpectedHttpStatusCode="404" ExpectedResponseUrl="{{web}}b" ReportingName="" />`},
+		{"same requests", testRequest("POST", "g1", "{{web}}a", "", "") +
+			testRequest("POST", "g2", "{{web}}a", "", "")},
+		{"dependent requests", testRequest("POST", "g1", "{{web}}a", "",
+			"<DependentRequests>"+testRequest("POST", "g2", "{{web}}b.png",
+				`Cache="True"`, testBody("x\r\n\r\ny"))+"</DependentRequests>")},
+	}
+	for _, tt := range tests {
+		source := testWebTest(tt.items)
+		base, err := Parse(strings.NewReader(source))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		text := dumpText(t, source, DumpOptions{Asis: true})
+		built, err := buildText(text, base)
+		if err != nil {
+			t.Errorf("%s: %v\n%s", tt.name, err, text)
+			continue
+		}
+		if want := encodeSource(t, source); built != want {
+			t.Errorf("%s: built\n%s\nwant\n%s\nfrom\n%s", tt.name, built, want, text)
+		}
+	}
+}
+
+func TestBuildNoBase(t *testing.T) {
+	text := "WT: " + `<WebTest Name="Login" Owner="" Priority="1" Enabled="True" Description="" CredentialUserName="" CredentialPassword="" PreAuthenticate="True" Proxy="default" StopOnError="True"></WebTest>` + "\r\n\r\n" +
+		"P: (0,300) {{web}}a.svc  ():True\r\n  |<a>\r\n  |\r\n  | </a>\r\n  S: (text/xml)\r\n  A: Cache=\"True\"\r\n\r\n"
+	built, err := buildText(text, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := Parse(strings.NewReader(built))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wt.Name != "Login" || wt.StopOnError != "True" {
+		t.Errorf("settings not taken from the WT: line: %s %s", wt.Name, wt.StopOnError)
+	}
+	r := wt.Items[0].(*Request)
+	if body := DecodeStringBody(r.StringBody()); body != "<a>\r\n\r\n</a>" {
+		t.Errorf("body %q", body)
+	}
+	if r.Cache != "True" || r.FollowRedirects != "True" || len(r.Guid) != 36 {
+		t.Errorf("attributes %s %s %s", r.Cache, r.FollowRedirects, r.Guid)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		err  string
+	}{
+		{"P: (0,300) {{web}}a.svc  ():True\r\n  | <a>&amp;</a>\r\n  S: (text/xml) decoded\r\n",
+			"line 3: the StringBody is shown XML decoded"},
+		{"G: (0,300) {{web}}a ():True\r\n  V: (My Rule) \r\n",
+			"line 2: unknown rule class for 'My Rule'"},
+		{`WT: <WebTest Name="A" CredentialPassword="***"></WebTest>` + "\r\n",
+			"line 1: the CredentialPassword is masked"},
+		{"  | <a/>\r\n", "line 1: StringBody line out of a request"},
+		{"G: (0,300) {{web}}a ():True\r\n  A: Cache=\"True\r\n",
+			"line 2: bad A: line"},
+		{"T: t\r\nG: (0,300) {{web}}a ():True\r\n", "T: block is not closed"},
+	}
+	for _, tt := range tests {
+		_, err := buildText(tt.text, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error %v, want %q", tt.text, err, tt.err)
+		}
+	}
+}
+
+// TestBuildSample dumps the whole sample web test and builds it back, with
+// it as the base, the same as it is
+func TestBuildSample(t *testing.T) {
+	source := readSample(t)
+	base, err := Parse(bytes.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := dumpText(t, string(source), DumpOptions{Asis: true})
+	built, err := buildText(text, base)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, text)
+	}
+	if built != string(source) {
+		t.Errorf("built\n%s\nwant\n%s\nfrom\n%s", built, source, text)
+	}
+}
+
+func TestBuildInclude(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{`I: <IncludedWebTest Name="Other" Path="..\common\other.webtest" Id="i1" IsCodedWebTest="False" InheritWebTestSettings="True" />`,
+			`<IncludedWebTest Name="Other" Path="..\common\other.webtest" Id="i1" IsCodedWebTest="False" InheritWebTestSettings="True" />`},
+		{"I: Other", `<IncludedWebTest Name="Other" Path="Other.webtest" />`},
+	}
+	for _, tt := range tests {
+		built, err := buildText(tt.line+"\r\n", nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+		} else if !strings.Contains(built, "    "+tt.want+"\r\n") {
+			t.Errorf("%s: built\n%s", tt.line, built)
+		}
+	}
+}
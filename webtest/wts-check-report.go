@@ -0,0 +1,276 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-check-report
+// Purpose: wts (web test script) check findings summary and reports
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// severityLevels orders the finding severities
+var severityLevels = map[string]int{"info": 1, "warning": 2, "error": 3}
+
+// checkFileReport is the json report of one web test script
+type checkFileReport struct {
+	File              string    `json:"file"`
+	Summary           string    `json:"summary"`
+	Requests          int       `json:"requests"`
+	DependentRequests int       `json:"dependent_requests"`
+	Findings          []Finding `json:"findings"`
+}
+
+// checkReport is the json report of all the web test scripts checked, in
+// the same shape however many there are
+type checkReport struct {
+	Summary string            `json:"summary"`
+	Files   []checkFileReport `json:"files"`
+}
+
+/*
+JUnit XML, one testcase per finding
+*/
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+/*
+SARIF 2.1.0, the minimal subset code scanning tools take
+*/
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver struct {
+		Name  string      `json:"name"`
+		Rules []sarifRule `json:"rules"`
+	} `json:"driver"`
+}
+
+type sarifRule struct {
+	Id               string    `json:"id"`
+	ShortDescription sarifText `json:"shortDescription"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifText         `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			Uri string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// IsSeverity tells whether s is a known severity, info, warning or error
+func IsSeverity(s string) bool {
+	_, ok := severityLevels[s]
+	return ok
+}
+
+// CheckSummary tells how many findings of each severity there are
+func CheckSummary(findings []Finding) string {
+	count := map[string]int{}
+	for _, f := range findings {
+		count[f.Severity]++
+	}
+	var levels []string
+	for s := range count {
+		levels = append(levels, s)
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return severityLevels[levels[i]] > severityLevels[levels[j]]
+	})
+	parts := make([]string, len(levels))
+	for i, s := range levels {
+		parts[i] = fmt.Sprintf("%d %s", count[s], s)
+	}
+	if len(parts) == 0 {
+		return "no findings"
+	}
+	return fmt.Sprintf("%d finding(s): %s", len(findings), strings.Join(parts, ", "))
+}
+
+// CountFailing counts the findings at or above the failOn severity
+func CountFailing(findings []Finding, failOn string) int {
+	min := severityLevels[failOn]
+	n := 0
+	for _, f := range findings {
+		if severityLevels[f.Severity] >= min {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteFindings writes the findings of the scripts in the given format,
+// json, junit or sarif
+func WriteFindings(w io.Writer, format string, results []*CheckResult) error {
+	switch format {
+	case "json":
+		return writeJson(w, results)
+	case "junit":
+		return writeJUnit(w, results)
+	case "sarif":
+		return writeSarif(w, results)
+	}
+	return fmt.Errorf("unknown report format '%s'", format)
+}
+
+// writeJson writes the report of the scripts as a list of them, with the
+// overall summary, even for a single script
+func writeJson(w io.Writer, results []*CheckResult) error {
+	var all []Finding
+	files := make([]checkFileReport, len(results))
+	for i, r := range results {
+		files[i] = checkFileReport{r.Script, CheckSummary(r.Findings),
+			r.Requests, r.DependentRequests, r.Findings}
+		if files[i].Findings == nil {
+			files[i].Findings = []Finding{}
+		}
+		all = append(all, r.Findings...)
+	}
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "  ")
+	return e.Encode(checkReport{CheckSummary(all), files})
+}
+
+// Where tells the request of the finding, #n, or #n.d for the dth
+// dependent request of the nth request
+func (f Finding) Where() string {
+	if f.Dependent != 0 {
+		return fmt.Sprintf("#%d.%d", f.Request, f.Dependent)
+	}
+	return fmt.Sprintf("#%d", f.Request)
+}
+
+// writeJUnit writes one testsuite per script
+func writeJUnit(w io.Writer, results []*CheckResult) error {
+	var suites junitTestSuites
+	for _, r := range results {
+		suites.Suites = append(suites.Suites,
+			junitSuite(r.Script, r.Findings))
+	}
+	io.WriteString(w, xml.Header)
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitSuite(script string, findings []Finding) junitTestSuite {
+	suite := junitTestSuite{Name: script, Tests: len(findings),
+		Failures: len(findings)}
+	for _, f := range findings {
+		suite.TestCases = append(suite.TestCases, junitTestCase{
+			ClassName: script,
+			Name: fmt.Sprintf("%s %s: %s", f.Where(), f.Transaction,
+				f.Rule),
+			Failure: &junitFailure{Message: f.Message, Type: f.Severity,
+				Text: fmt.Sprintf("%s\nComment: %s\nUrl: %s",
+					f.Message, f.Comment, f.Url)},
+		})
+	}
+	if len(findings) == 0 {
+		suite.Tests = 1
+		suite.TestCases = []junitTestCase{{ClassName: script, Name: "check"}}
+	}
+	return suite
+}
+
+// writeSarif writes a single run, the results located by their scripts
+// and the lines of their requests
+func writeSarif(w io.Writer, results []*CheckResult) error {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = progname
+	for _, id := range lintRuleIds() {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules,
+			sarifRule{Id: id, ShortDescription: sarifText{lintRules[id].desc}})
+	}
+	for _, r := range results {
+		for _, f := range r.Findings {
+			level := map[string]string{"error": "error", "warning": "warning",
+				"info": "note"}[f.Severity]
+			if len(level) == 0 {
+				level = "warning"
+			}
+			var loc sarifLocation
+			loc.PhysicalLocation.ArtifactLocation.Uri = r.Script
+			if f.Line != 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{f.Line}
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleId: f.Rule, Level: level, Message: sarifText{f.Message},
+				Locations: []sarifLocation{loc},
+				Properties: map[string]string{
+					"transaction": f.Transaction, "comment": f.Comment,
+					"request": f.Where()[1:]},
+			})
+		}
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(sarifLog{Version: "2.1.0",
+		Schema: "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:   []sarifRun{run}})
+}
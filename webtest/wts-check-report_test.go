@@ -0,0 +1,142 @@
+package webtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckSummary(t *testing.T) {
+	findings := []Finding{{Severity: "warning"}, {Severity: "error"},
+		{Severity: "info"}, {Severity: "warning"}}
+	tests := []struct {
+		findings []Finding
+		failOn   string
+		summary  string
+		failing  int
+	}{
+		{nil, "", "no findings", 0},
+		{findings, "", "4 finding(s): 1 error, 2 warning, 1 info", 4},
+		{findings, "warning", "4 finding(s): 1 error, 2 warning, 1 info", 3},
+		{findings, "error", "4 finding(s): 1 error, 2 warning, 1 info", 1},
+		{findings[:1], "error", "1 finding(s): 1 warning", 0},
+	}
+	for _, tt := range tests {
+		if got := CheckSummary(tt.findings); got != tt.summary {
+			t.Errorf("summary %q, want %q", got, tt.summary)
+		}
+		if got := CountFailing(tt.findings, tt.failOn); got != tt.failing {
+			t.Errorf("%q: %d failing, want %d", tt.failOn, got, tt.failing)
+		}
+	}
+}
+
+// sampleResults checks the sample web test, with the default rules
+func sampleResults(t *testing.T) []*CheckResult {
+	res, err := checkWith(t, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*CheckResult{res}
+}
+
+func TestWriteFindings(t *testing.T) {
+	results := sampleResults(t)
+	var buf bytes.Buffer
+
+	// json, of a single script in the same shape as of several
+	for _, n := range []int{1, 2} {
+		buf.Reset()
+		if err := WriteFindings(&buf, "json", append(results, results[0])[:n]); err != nil {
+			t.Fatal(err)
+		}
+		var report checkReport
+		if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Files) != n || !strings.HasPrefix(report.Summary, strconv.Itoa(8*n)+" finding(s)") {
+			t.Fatalf("json report of %d: %+v", n, report)
+		}
+		if f := report.Files[0]; f.File != "Sample.webtest" || f.Requests != 3 ||
+			len(f.Findings) != 8 || f.Findings[1].Line != 7 {
+			t.Errorf("json report of %d: %+v", n, f)
+		}
+	}
+
+	// junit, a testcase per finding
+	buf.Reset()
+	if err := WriteFindings(&buf, "junit", results); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	s := suites.Suites[0]
+	if s.Tests != 8 || s.Failures != 8 ||
+		s.TestCases[4].Name != "#1.1 Login: hardcoded-host" {
+		t.Errorf("junit report %+v", s)
+	}
+
+	// sarif, located by the request lines
+	buf.Reset()
+	if err := WriteFindings(&buf, "sarif", results); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, r := range log.Runs[0].Results {
+		loc := r.Locations[0].PhysicalLocation
+		line := "-"
+		if loc.Region != nil {
+			line = strconv.Itoa(loc.Region.StartLine)
+		}
+		lines = append(lines, r.Level+"@"+line)
+		if loc.ArtifactLocation.Uri != "Sample.webtest" {
+			t.Errorf("sarif uri %s", loc.ArtifactLocation.Uri)
+		}
+	}
+	want := "warning@- error@7 warning@7 warning@7 error@20 warning@20 error@51 warning@66"
+	if got := strings.Join(lines, " "); got != want {
+		t.Errorf("sarif results\n%s\nwant\n%s", got, want)
+	}
+
+	if err := WriteFindings(&buf, "csv", results); err == nil {
+		t.Errorf("no error for an unknown format")
+	}
+}
+
+func TestCheckPartial(t *testing.T) {
+	source := `<WebTest Name="T" StopOnError="True">
+  <Items>
+    ` + `<Request Method="GET" Url="http://a/1" ThinkTime="0" Timeout="300" RecordResult="True" />
+    <TransactionTimer><Items /></TransactionTimer>
+    <Request Method="GET" Url="http://a/2" ThinkTime="0" Timeout="300" RecordResult="True" />
+  </Items>
+</WebTest>`
+	for _, keepGoing := range []bool{false, true} {
+		c, err := NewChecker(CheckOptions{Timeout: 270, KeepGoing: keepGoing})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := c.Check("T.webtest", strings.NewReader(source), &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "4:5: bad <TransactionTimer> element") {
+			t.Errorf("keep-going %v: error %v", keepGoing, err)
+		}
+		want := "hardcoded-host(error)@1.0"
+		if keepGoing {
+			want += " hardcoded-host(error)@2.0"
+		}
+		if res == nil {
+			t.Errorf("keep-going %v: no findings with the error", keepGoing)
+		} else if got := findingList(res.Findings); got != want {
+			t.Errorf("keep-going %v: got %s, want %s", keepGoing, got, want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-correlate
+// Purpose: wts (web test script) correlation candidate detection
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// CorrelateOptions tells how to find the correlation candidates
+type CorrelateOptions struct {
+	// Min is the minimum number of requests a token is used in, 2 at least
+	Min int
+}
+
+// corrKinds are the kinds of dynamic looking tokens, in order of matching.
+// Go regexp alternation prefers the leftmost alternative, so a GUID is not
+// taken as hex digits, and hex digits are not taken as base64
+var corrKinds = []struct{ name, re string }{
+	{"Guid", `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`},
+	{"Hex", `\b[0-9a-fA-F]{16,}\b`},
+	{"Base64", `[A-Za-z0-9+/]{20,}={0,2}`},
+	{"Id", `\b[0-9]{5,}\b`},
+}
+
+var corrRe *regexp.Regexp
+
+// corrUsage is where a token is used, the location being U for the Url,
+// B for the StringBody, or H:/Q:/F: and the header/query/form parameter name
+type corrUsage struct {
+	index    int // the request number within the web test, 1-based
+	dep      int // the dependent request number within it, 1-based
+	trans    string
+	method   string
+	url      string
+	location string
+}
+
+// corrToken is a correlation candidate
+type corrToken struct {
+	value  string
+	kind   string
+	usages []corrUsage
+}
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+func init() {
+	re := ""
+	for i, k := range corrKinds {
+		if i > 0 {
+			re += "|"
+		}
+		re += "(" + k.re + ")"
+	}
+	corrRe = regexp.MustCompile(re)
+}
+
+// Correlate reports the correlation candidates of the web test to w, the
+// dynamic looking tokens used in at least Min requests, and returns the
+// placeholder replacements of them, as the rules of a .rawrule file
+func (wt *WebTest) Correlate(w io.Writer, opt CorrelateOptions) *RawRule {
+	min := opt.Min
+	if min < 2 {
+		min = 2
+	}
+	tokens := corrCandidates(wt, min)
+	corrReport(w, tokens)
+	return corrRawRule(tokens)
+}
+
+// corrCandidates finds the dynamic looking tokens used in at least min
+// requests, dependent requests included, in the order they are first seen
+func corrCandidates(wt *WebTest, min int) []*corrToken {
+	found := map[string]*corrToken{}
+	var order []*corrToken
+	// the requests are numbered the way the check verb does, #n, or #n.d
+	// for the dth dependent request of the nth one
+	index, dep := 0, 0
+
+	var walk func(r *Request, trans string)
+	walk = func(r *Request, trans string) {
+		use := func(location, text string) {
+			for _, m := range corrRe.FindAllStringSubmatch(text, -1) {
+				kind := corrKind(m)
+				if len(kind) == 0 {
+					continue
+				}
+				t, ok := found[m[0]]
+				if !ok {
+					t = &corrToken{value: m[0], kind: kind}
+					found[m[0]] = t
+					order = append(order, t)
+				}
+				t.usages = append(t.usages,
+					corrUsage{index, dep, trans, r.Method, r.Url, location})
+			}
+		}
+
+		use("U", r.Url)
+		for _, v := range r.Headers {
+			use("H:"+v.Name, v.Value)
+		}
+		for _, v := range r.QueryStringParameters {
+			use("Q:"+v.Name, v.Value)
+		}
+		if r.FormPostHttpBody != nil {
+			for _, v := range r.FormPostHttpBody.FormPostParameter {
+				use("F:"+v.Name, v.Value)
+			}
+		}
+		if r.StringHttpBody != nil {
+			use("B", DecodeStringBody(r.StringBody()))
+		}
+		for _, d := range r.DependentRequests {
+			dep++
+			walk(d, trans)
+		}
+	}
+	wt.Items.Walk("", func(r *Request, trans string) {
+		index, dep = index+1, 0
+		walk(r, trans)
+	})
+
+	var tokens []*corrToken
+	for _, t := range order {
+		if t.requests() >= min {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// corrKind tells the kind of the matched token, or "" if it does not look
+// dynamic enough, e.g., a base64 one that is an ordinary word or a path
+func corrKind(m []string) string {
+	for i, k := range corrKinds {
+		if len(m[i+1]) == 0 {
+			continue
+		}
+		if k.name == "Base64" && (!corrMixed(m[0]) || corrPath(m[0])) {
+			return ""
+		}
+		return k.name
+	}
+	return ""
+}
+
+// corrMixed tells whether s has upper and lower case letters and digits
+func corrMixed(s string) bool {
+	var upper, lower, digit bool
+	for _, c := range s {
+		upper = upper || unicode.IsUpper(c)
+		lower = lower || unicode.IsLower(c)
+		digit = digit || unicode.IsDigit(c)
+	}
+	return upper && lower && digit
+}
+
+// corrPath tells whether s looks like a Url path, not base64, i.e., it has
+// more than a / in 16 characters, as base64 has one in 64 on average
+func corrPath(s string) bool {
+	return strings.Count(s, "/")*16 > len(s)
+}
+
+// requests counts the distinct requests the token is used in
+func (t *corrToken) requests() int {
+	n := 0
+	var last corrUsage
+	for _, u := range t.usages {
+		if u.index != last.index || u.dep != last.dep {
+			n, last = n+1, u
+		}
+	}
+	return n
+}
+
+// where tells the request of the usage, #n or #n.d, as the check verb
+func (u corrUsage) where() string {
+	return Finding{Request: u.index, Dependent: u.dep}.Where()
+}
+
+func corrReport(w io.Writer, tokens []*corrToken) {
+	for i, t := range tokens {
+		first := t.usages[0]
+		fmt.Fprintf(w, "C%d: %s (%s), in %d requests\n", i+1, t.value,
+			t.kind, t.requests())
+		fmt.Fprintf(w, "    first: %s [%s] %s %s (%s)\n", first.where(),
+			first.trans, first.method, first.url, first.location)
+		for _, u := range t.usages[1:] {
+			fmt.Fprintf(w, "    used:  %s [%s] %s %s (%s)\n", u.where(),
+				u.trans, u.method, u.url, u.location)
+		}
+	}
+	fmt.Fprintf(w, "\n%d correlation candidate(s)\n", len(tokens))
+}
+
+// corrRawRule makes the placeholder replacements of the tokens into the
+// rules of a .rawrule file, numbering the placeholders per kind
+func corrRawRule(tokens []*corrToken) *RawRule {
+	count := map[string]int{}
+	names := map[*corrToken]string{}
+	for _, t := range tokens {
+		count[t.kind]++
+		names[t] = fmt.Sprintf("{{Param_%s_%d}}", t.kind, count[t.kind])
+	}
+	// longer tokens first, so that no token is replaced within another
+	sorted := append([]*corrToken{}, tokens...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].value) > len(sorted[j].value)
+	})
+	rule := &RawRule{}
+	for _, t := range sorted {
+		rule.Rules = append(rule.Rules, RawReplace{
+			Regexp: regexp.QuoteMeta(t.value), Replace: names[t],
+			Scope: []string{"url", "header", "query", "form", "body"}})
+	}
+	return rule
+}
@@ -0,0 +1,96 @@
+package webtest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCorrKind(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"id=0b0e1c1e-7a8c-4b5e-9a3c-7d5b8e2c1f01&x", "Guid 0b0e1c1e-7a8c-4b5e-9a3c-7d5b8e2c1f01"},
+		{"<Hash>0123456789abcdef0123</Hash>", "Hex 0123456789abcdef0123"},
+		{"t=dDwtMTA4NzI2NTQ4Nzs7Pj+aB/9x==", "Base64 dDwtMTA4NzI2NTQ4Nzs7Pj+aB/9x=="},
+		{"Q2hhcmxlcy9EYXJ3aW4vMTg1OQ/Zk", "Base64 Q2hhcmxlcy9EYXJ3aW4vMTg1OQ/Zk"},
+		{"/force/u/CB42/Account/LogOnPage", ""},
+		{"AnOrdinaryLongIdentifierName", ""},
+		{"order 1234567 of 42", "Id 1234567"},
+		{"2016-03-12", ""},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, m := range corrRe.FindAllStringSubmatch(tt.text, -1) {
+			if kind := corrKind(m); len(kind) != 0 {
+				got = append(got, kind+" "+m[0])
+			}
+		}
+		if strings.Join(got, ", ") != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCorrCandidates(t *testing.T) {
+	ticket := "dDwtMTA4NzI2NTQ4Nzs7Pj+aB/9x"
+	items := testRequest("GET", "g1", "{{web}}login", "",
+		"<DependentRequests>"+
+			testRequest("GET", "g2", "{{web}}logo.png?s="+ticket, "", "")+
+			"</DependentRequests>") +
+		`<TransactionTimer Name="T"><Items>` +
+		testRequest("POST", "g3", "{{web}}a.svc", "",
+			`<Headers><Header Name="X-Ticket" Value="`+ticket+`" /></Headers>`+
+				testBody("<Id>1234567</Id><T>"+ticket+"</T>")) +
+		`</Items></TransactionTimer>` +
+		testRequest("GET", "g4", "{{web}}item/1234567", "", "")
+	wt, err := Parse(strings.NewReader(testWebTest(items)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	corrReport(&buf, corrCandidates(wt, 2))
+	want := `C1: ` + ticket + ` (Base64), in 2 requests
+    first: #1.1 [] GET {{web}}logo.png?s=` + ticket + ` (U)
+    used:  #2 [T] POST {{web}}a.svc (H:X-Ticket)
+    used:  #2 [T] POST {{web}}a.svc (B)
+C2: 1234567 (Id), in 2 requests
+    first: #2 [T] POST {{web}}a.svc (B)
+    used:  #3 [] GET {{web}}item/1234567 (U)
+
+2 correlation candidate(s)
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	corrReport(&buf, corrCandidates(wt, 3))
+	if buf.String() != "\n0 correlation candidate(s)\n" {
+		t.Errorf("min 3: got\n%s", buf.String())
+	}
+}
+
+func TestCorrRawRule(t *testing.T) {
+	tokens := []*corrToken{{value: "1234567", kind: "Id"},
+		{value: "a+b/c", kind: "Base64"}, {value: "12345678", kind: "Id"}}
+	var buf bytes.Buffer
+	if err := corrRawRule(tokens).Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `rules:
+  - regexp: "12345678"
+    replace: '{{Param_Id_2}}'
+    scope: [url, header, query, form, body]
+  - regexp: "1234567"
+    replace: '{{Param_Id_1}}'
+    scope: [url, header, query, form, body]
+  - regexp: a\+b/c
+    replace: '{{Param_Base64_1}}'
+    scope: [url, header, query, form, body]
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,294 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-diff
+// Purpose: wts (web test script) semantic diff handling
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"fmt"
+	"io"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// DiffOptions tells how to compare the web test scripts
+type DiffOptions struct {
+	// Exact compares as-is, without the raw mode normalizations and the
+	// time string removal
+	Exact bool
+}
+
+// Differ compares the web test scripts request by request, normalizing
+// their volatile values the way the dump does in raw mode
+type Differ struct {
+	dp  *Dumper
+	opt DiffOptions
+}
+
+// diffField is a named value of a request, for per-field comparison
+type diffField struct {
+	key, value string
+}
+
+// diffReq is a request flattened out for comparison
+type diffReq struct {
+	index  int // the request number within the web test, 1-based
+	trans  string
+	method string
+	url    string
+	body   string
+	// the fields, by their dump tags, A for the request attributes
+	fields map[string][]diffField
+}
+
+var diffTags = []string{"A", "H", "Q", "F", "E", "V", "B"}
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// NewDiffer makes a Differ that normalizes the volatile values with the
+// .rawrule file of the script, unless Exact
+func NewDiffer(script string, opt DiffOptions) (*Differ, error) {
+	// reuse the raw mode normalizations of the dump
+	dp, err := NewDumper(script, DumpOptions{Raw: !opt.Exact, Tsr: !opt.Exact})
+	if err != nil {
+		return nil, err
+	}
+	return &Differ{dp, opt}, nil
+}
+
+// RawRule tells the .rawrule file in use, "" if none
+func (df *Differ) RawRule() string {
+	return df.dp.RawRule()
+}
+
+// Diff reports the requests added, removed and changed from the web test
+// script a to b to w. The errors tell the file names as well if a and b
+// are files
+func (df *Differ) Diff(w io.Writer, a, b io.Reader) error {
+	df.dp.Reset()
+	ra, err := df.requests(a)
+	if err != nil {
+		return err
+	}
+	df.dp.Reset()
+	rb, err := df.requests(b)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", fileName(a), fileName(b))
+	added, removed, changed := diffReport(w, ra, rb)
+	fmt.Fprintf(w, "\n%d added, %d removed, %d changed\n", added, removed, changed)
+	return nil
+}
+
+// requests reads the web test script and flattens its requests
+func (df *Differ) requests(r io.Reader) ([]*diffReq, error) {
+	wt, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var reqs []*diffReq
+	wt.Items.Walk("", func(r *Request, trans string) {
+		reqs = append(reqs, df.newDiffReq(r, trans, len(reqs)+1))
+	})
+	return reqs, nil
+}
+
+// newDiffReq flattens the request, normalizing its volatile values the
+// same way the dump does in raw mode
+func (df *Differ) newDiffReq(r *Request, trans string, index int) *diffReq {
+	dp := df.dp
+	d := &diffReq{index: index, trans: trans, method: r.Method,
+		url: dp.Url(r.Url), fields: map[string][]diffField{}}
+	if r.StringHttpBody != nil {
+		d.body = dp.Body(r)
+	}
+
+	add := func(tag, key, value string) {
+		d.fields[tag] = append(d.fields[tag], diffField{key, value})
+	}
+	add("A", "RecordResult", r.RecordResult)
+	add("A", "ReportingName", r.ReportingName)
+	if df.opt.Exact {
+		add("A", "ThinkTime", r.ThinkTime)
+		add("A", "Timeout", r.Timeout)
+	}
+	for _, v := range r.Headers {
+		add("H", v.Name, dp.Value("header", v.Value))
+	}
+	for _, v := range r.QueryStringParameters {
+		add("Q", v.Name, dp.Value("query", v.Value))
+	}
+	if r.FormPostHttpBody != nil {
+		for _, v := range r.FormPostHttpBody.FormPostParameter {
+			add("F", v.Name, dp.Value("form", v.Value))
+		}
+		for _, v := range r.FormPostHttpBody.FileUploadParameter {
+			add("F", v.Name, v.FileName)
+		}
+	}
+	for _, v := range r.ExtractionRules {
+		add("E", v.DisplayName+": "+v.VariableName,
+			dp.Value("", InlineXml(v.RuleParameters)))
+	}
+	for _, v := range r.ValidationRules {
+		add("V", v.DisplayName, dp.Value("", InlineXml(v.RuleParameters)))
+	}
+	add("B", "body", d.body)
+	if r.StringHttpBody != nil {
+		add("B", "ContentType", r.StringHttpBody.ContentType)
+	}
+	if r.BinaryHttpBody != nil {
+		add("B", "binary", r.BinaryHttpBody.ContentType+" "+r.BinaryHttpBody.Data)
+	}
+	return d
+}
+
+// key is what aligns the requests of the two web tests
+func (d *diffReq) key() string {
+	return d.trans + "\n" + d.method + "\n" + d.url + "\n" + d.body
+}
+
+// coarseKey pairs up the unaligned requests as changed ones
+func (d *diffReq) coarseKey() string {
+	return d.trans + "\n" + d.method + "\n" + d.url
+}
+
+func (d *diffReq) String() string {
+	return fmt.Sprintf("[%s] %s %s", d.trans, d.method, d.url)
+}
+
+// diffReport aligns the two lists of requests and reports the differences
+func diffReport(w io.Writer, ra, rb []*diffReq) (added, removed, changed int) {
+	// longest common subsequence on the request keys
+	n, m := len(ra), len(rb)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if ra[i].key() == rb[j].key() {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// gaps of unaligned requests in between are paired by coarse key
+	var gapa, gapb []*diffReq
+	flush := func() {
+		used := make([]bool, len(gapb))
+		for _, a := range gapa {
+			found := false
+			for j, b := range gapb {
+				if !used[j] && a.coarseKey() == b.coarseKey() {
+					used[j], found = true, true
+					diffChanged(w, a, b)
+					changed++
+					break
+				}
+			}
+			if !found {
+				fmt.Fprintf(w, "- %s (#%d)\n", a, a.index)
+				removed++
+			}
+		}
+		for j, b := range gapb {
+			if !used[j] {
+				fmt.Fprintf(w, "+ %s (#%d)\n", b, b.index)
+				added++
+			}
+		}
+		gapa, gapb = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case ra[i].key() == rb[j].key():
+			flush()
+			if diffFields(nil, ra[i], rb[j]) {
+				diffChanged(w, ra[i], rb[j])
+				changed++
+			}
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			gapa = append(gapa, ra[i])
+			i++
+		default:
+			gapb = append(gapb, rb[j])
+			j++
+		}
+	}
+	gapa = append(gapa, ra[i:]...)
+	gapb = append(gapb, rb[j:]...)
+	flush()
+	return
+}
+
+func diffChanged(w io.Writer, a, b *diffReq) {
+	fmt.Fprintf(w, "~ %s (#%d => #%d)\n", a, a.index, b.index)
+	diffFields(w, a, b)
+}
+
+// diffFields reports the per-field differences of the two requests to w,
+// if w is not nil, and tells whether there are any
+func diffFields(w io.Writer, a, b *diffReq) bool {
+	found := false
+	for _, tag := range diffTags {
+		fa, fb := diffIndex(a.fields[tag]), diffIndex(b.fields[tag])
+		for _, f := range a.fields[tag] {
+			k := f.key
+			vb, ok := fb[k]
+			switch {
+			case !ok:
+				found = true
+				if w != nil {
+					fmt.Fprintf(w, "    %s: -%s: %q\n", tag, k, f.value)
+				}
+			case vb != fa[k]:
+				found = true
+				if w != nil {
+					fmt.Fprintf(w, "    %s: %s: %q => %q\n", tag, k, fa[k], vb)
+				}
+			}
+			delete(fb, k)
+			delete(fa, k)
+		}
+		for _, f := range b.fields[tag] {
+			if v, ok := fb[f.key]; ok {
+				found = true
+				if w != nil {
+					fmt.Fprintf(w, "    %s: +%s: %q\n", tag, f.key, v)
+				}
+				delete(fb, f.key)
+			}
+		}
+	}
+	return found
+}
+
+// diffIndex indexes the fields by key, numbering the repeated ones
+func diffIndex(fields []diffField) map[string]string {
+	index := map[string]string{}
+	seen := map[string]int{}
+	for i, f := range fields {
+		if n := seen[f.key]; n > 0 {
+			fields[i].key = fmt.Sprintf("%s#%d", f.key, n+1)
+		}
+		seen[f.key]++
+		index[fields[i].key] = f.value
+	}
+	return index
+}
@@ -0,0 +1,75 @@
+package webtest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testDiff diffs the two web tests, of the items given, the way the diff
+// verb does
+func testDiff(t *testing.T, itemsa, itemsb string) string {
+	dir, err := ioutil.TempDir("", "wts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	df, err := NewDiffer(filepath.Join(dir, "a.webtest"), DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reqs [2][]*diffReq
+	for i, items := range []string{itemsa, itemsb} {
+		df.dp.Reset()
+		if reqs[i], err = df.requests(strings.NewReader(testWebTest(items))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	diffReport(&buf, reqs[0], reqs[1])
+	return buf.String()
+}
+
+func TestDiff(t *testing.T) {
+	login := testRequest("GET", "g1", "http://web01.example.com/login", "", "")
+	query := func(v string) string {
+		return testRequest("GET", "g2", "{{web}}find", "",
+			`<QueryStringParameters><QueryStringParameter Name="v" Value="`+v+
+				`" RecordedValue="" CorrelationBinding="" UrlEncode="True" /></QueryStringParameters>`)
+	}
+	post := func(body string) string {
+		return testRequest("POST", "g3", "{{web}}a.svc", "", testBody(body))
+	}
+	tests := []struct {
+		name           string
+		itemsa, itemsb string
+		want           string
+	}{
+		{"same", login + query("1"), login + query("1"), ""},
+		{"server and time strings normalized",
+			login + post("<When>2016-03-12T10:11:12</When>"),
+			testRequest("GET", "g1", "http://web02.example.com/login", "", "") +
+				post("<When>2016-04-01T08:00:00</When>"), ""},
+		{"inserted", login + query("1"),
+			login + post("<a/>") + query("1"),
+			"+ [] POST {{web}}a.svc (#2)\n"},
+		{"removed", login + query("1"), query("1"),
+			"- [] GET {{Param_TestServer}}/login (#1)\n"},
+		{"changed query", login + query("1"), login + query("2"),
+			"~ [] GET {{web}}find (#2 => #2)\n    Q: v: \"1\" => \"2\"\n"},
+		{"changed body", post("<a>1</a>"), post("<a>2</a>"),
+			"~ [] POST {{web}}a.svc (#1 => #1)\n    B: body: \"<a>1</a>\" => \"<a>2</a>\"\n"},
+		{"in transaction", `<TransactionTimer Name="T"><Items>` + login +
+			`</Items></TransactionTimer>`, login,
+			"- [T] GET {{Param_TestServer}}/login (#1)\n" +
+				"+ [] GET {{Param_TestServer}}/login (#1)\n"},
+	}
+	for _, tt := range tests {
+		if got := testDiff(t, tt.itemsa, tt.itemsb); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-dump-format
+// Purpose: wts (web test script) dump in structured formats, json or yaml
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+)
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// dumpDocument is what the json/yaml dump outputs
+type dumpDocument struct {
+	Settings          *Settings         `json:"settings,omitempty" yaml:"settings,omitempty"`
+	Plugins           []dumpRule        `json:"plugins,omitempty" yaml:"plugins,omitempty"`
+	Requests          []dumpRequest     `json:"requests" yaml:"requests"`
+	ContextParameters map[string]string `json:"context_parameters" yaml:"context_parameters"`
+	DataSources       []dumpDataSource  `json:"data_sources,omitempty" yaml:"data_sources,omitempty"`
+	ValidationRules   []dumpRule        `json:"validation_rules,omitempty" yaml:"validation_rules,omitempty"`
+	TimeStrings       map[string]int    `json:"time_strings,omitempty" yaml:"time_strings,omitempty"`
+}
+
+// dumpRequest holds what treatRequest and dealReqAddons gather
+type dumpRequest struct {
+	Transaction     string          `json:"transaction" yaml:"transaction"`
+	Comment         string          `json:"comment" yaml:"comment"`
+	Method          string          `json:"method" yaml:"method"`
+	Url             string          `json:"url" yaml:"url"`
+	ThinkTime       string          `json:"think_time" yaml:"think_time"`
+	Timeout         string          `json:"timeout" yaml:"timeout"`
+	ReportingName   string          `json:"reporting_name" yaml:"reporting_name"`
+	RecordResult    string          `json:"record_result" yaml:"record_result"`
+	Service         string          `json:"service,omitempty" yaml:"service,omitempty"`
+	Body            string          `json:"body,omitempty" yaml:"body,omitempty"`
+	ContentType     string          `json:"content_type,omitempty" yaml:"content_type,omitempty"`
+	Binary          *dumpBinary     `json:"binary,omitempty" yaml:"binary,omitempty"`
+	Headers         []dumpHeader    `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Query           []dumpParam     `json:"query,omitempty" yaml:"query,omitempty"`
+	Form            []dumpParam     `json:"form,omitempty" yaml:"form,omitempty"`
+	Files           []dumpFile      `json:"files,omitempty" yaml:"files,omitempty"`
+	Plugins         []dumpRule      `json:"plugins,omitempty" yaml:"plugins,omitempty"`
+	ExtractionRules []dumpExtractor `json:"extraction_rules,omitempty" yaml:"extraction_rules,omitempty"`
+	ValidationRules []dumpRule      `json:"validation_rules,omitempty" yaml:"validation_rules,omitempty"`
+	Dependents      []dumpRequest   `json:"dependents,omitempty" yaml:"dependents,omitempty"`
+}
+
+type dumpHeader struct {
+	Name  string `json:"name" yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
+
+type dumpParam struct {
+	Name      string `json:"name" yaml:"name"`
+	Value     string `json:"value" yaml:"value"`
+	UrlEncode bool   `json:"url_encode" yaml:"url_encode"`
+}
+
+// dumpBinary is the BinaryHttpBody, its Data left base64 encoded
+type dumpBinary struct {
+	ContentType string `json:"content_type" yaml:"content_type"`
+	Data        string `json:"data" yaml:"data"`
+}
+
+type dumpFile struct {
+	Name        string `json:"name" yaml:"name"`
+	FileName    string `json:"file_name" yaml:"file_name"`
+	ContentType string `json:"content_type" yaml:"content_type"`
+}
+
+type dumpRule struct {
+	Name       string            `json:"name" yaml:"name"`
+	Parameters map[string]string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+type dumpExtractor struct {
+	Name       string            `json:"name" yaml:"name"`
+	Variable   string            `json:"variable" yaml:"variable"`
+	Parameters map[string]string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+type dumpDataSource struct {
+	Name       string      `json:"name" yaml:"name"`
+	Connection string      `json:"connection" yaml:"connection"`
+	Tables     []dumpTable `json:"tables" yaml:"tables"`
+}
+
+type dumpTable struct {
+	Name          string `json:"name" yaml:"name"`
+	SelectColumns string `json:"select_columns" yaml:"select_columns"`
+	AccessMethod  string `json:"access_method" yaml:"access_method"`
+}
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// dumpStructured walks the web test script the same way the text dump
+// does, but outputs the collected information as json or yaml
+func (dp *Dumper) dumpStructured(w io.Writer, decoder *xmlInput) error {
+	dp.doc = &dumpDocument{Requests: []dumpRequest{},
+		ContextParameters: map[string]string{}}
+	if err := dp.treatWtsXml(ioutil.Discard, decoder); err != nil {
+		return err
+	}
+	if dp.opt.Tsr {
+		dp.doc.TimeStrings = dp.dateCol
+	}
+
+	if dp.opt.Format == "yaml" {
+		e := yaml.NewEncoder(w)
+		e.SetIndent(2)
+		if err := e.Encode(dp.doc); err != nil {
+			return err
+		}
+		return e.Close()
+	}
+	// keep the bodies readable, not \u003c escaped
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "  ")
+	return e.Encode(dp.doc)
+}
+
+// dumpRecord adds the request to the structured dump, if it is wanted. A
+// dependent one, of depth > 0, goes to the last request of the depth above
+func (dp *Dumper) dumpRecord(r Request, cur current, service, body string,
+	depth int) {
+	if dp.doc == nil {
+		return
+	}
+	// r is normalized already in raw mode, like the text dump
+	d := dumpRequest{
+		Transaction: cur.transaction, Comment: dp.comment(cur.comment),
+		Method: r.Method, Url: r.Url, ThinkTime: r.ThinkTime, Timeout: r.Timeout,
+		ReportingName: r.ReportingName, RecordResult: r.RecordResult,
+		Service: service, Body: body,
+	}
+	if r.StringHttpBody != nil {
+		d.ContentType = r.StringHttpBody.ContentType
+	}
+	if r.BinaryHttpBody != nil {
+		d.Binary = &dumpBinary{r.BinaryHttpBody.ContentType, r.BinaryHttpBody.Data}
+	}
+	for _, v := range r.Headers {
+		d.Headers = append(d.Headers, dumpHeader{v.Name, v.Value})
+	}
+	for _, v := range r.QueryStringParameters {
+		d.Query = append(d.Query,
+			dumpParam{v.Name, v.Value, v.UrlEncode == "True"})
+	}
+	if r.FormPostHttpBody != nil {
+		for _, v := range r.FormPostHttpBody.FormPostParameter {
+			d.Form = append(d.Form,
+				dumpParam{v.Name, v.Value, v.UrlEncode == "True"})
+		}
+		for _, v := range r.FormPostHttpBody.FileUploadParameter {
+			d.Files = append(d.Files,
+				dumpFile{v.Name, v.FileName, v.ContentType})
+		}
+	}
+	for _, v := range r.RequestPlugins {
+		d.Plugins = append(d.Plugins,
+			dumpRule{v.DisplayName, ruleParams(v.RuleParameters)})
+	}
+	for _, v := range r.ExtractionRules {
+		d.ExtractionRules = append(d.ExtractionRules,
+			dumpExtractor{v.DisplayName, v.VariableName, ruleParams(v.RuleParameters)})
+	}
+	for _, v := range r.ValidationRules {
+		d.ValidationRules = append(d.ValidationRules,
+			dumpRule{v.DisplayName, ruleParams(v.RuleParameters)})
+	}
+	list := &dp.doc.Requests
+	for ; depth > 0; depth-- {
+		list = &(*list)[len(*list)-1].Dependents
+	}
+	*list = append(*list, d)
+}
+
+// dumpSource adds the data source to the structured dump, if it is wanted
+func (dp *Dumper) dumpSource(r DataSource) {
+	if dp.doc == nil {
+		return
+	}
+	d := dumpDataSource{Name: r.Name, Connection: r.Connection}
+	for _, t := range r.Tables {
+		d.Tables = append(d.Tables,
+			dumpTable{t.Name, t.SelectColumns, t.AccessMethod})
+	}
+	dp.doc.DataSources = append(dp.doc.DataSources, d)
+}
+
+// ruleParams turns the RuleParameters into a name => value map
+func ruleParams(params []RuleParameter) map[string]string {
+	if len(params) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(params))
+	for _, p := range params {
+		m[p.Name] = p.Value
+	}
+	return m
+}
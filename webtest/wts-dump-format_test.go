@@ -0,0 +1,125 @@
+package webtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// dumpSample dumps the sample web test with the options
+func dumpSample(t *testing.T, opt DumpOptions) []byte {
+	dp, err := NewDumper("testdata/sample.webtest", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("testdata/sample.webtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	if err := dp.Dump(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDumpStructured(t *testing.T) {
+	var doc, ydoc dumpDocument
+	if err := json.Unmarshal(dumpSample(t, DumpOptions{Format: "json"}), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(dumpSample(t, DumpOptions{Format: "yaml"}), &ydoc); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(doc, ydoc) {
+		t.Errorf("json and yaml differ:\n%+v\n%+v", doc, ydoc)
+	}
+	if len(doc.Requests) != 3 {
+		t.Fatalf("%d requests, want 3", len(doc.Requests))
+	}
+	login, svc, form := doc.Requests[0], doc.Requests[1], doc.Requests[2]
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"settings", doc.Settings.Name, "Sample"},
+		{"plugin parameters", doc.Plugins[0].Parameters, map[string]string{"User": "admin"}},
+		{"transaction", login.Transaction, "Login"},
+		{"comment", login.Comment, "[#1] start"},
+		{"think time and timeout", login.ThinkTime + "," + login.Timeout, "3,60"},
+		{"header", login.Headers, []dumpHeader{{"Authorization", `Bearer abc"def`}}},
+		{"query", login.Query, []dumpParam{{"v", "1.2", true}, {"d", "3/12/2016", true}}},
+		{"extraction rule", login.ExtractionRules, []dumpExtractor{{"Extract Hidden Fields", "1",
+			map[string]string{"Required": "True", "HtmlDecode": "True"}}}},
+		{"dependent", login.Dependents[0].Url, "http://web01.example.com/logo.png"},
+		{"out of transaction", svc.Transaction, ""},
+		{"body decoded", svc.Body, "<Request><ReadableCorrelator>corr-1</ReadableCorrelator><ReadableRequestName>GetThing</ReadableRequestName><SessionTicket>ABC123DEF</SessionTicket><When>2016-03-12T10:11:12</When></Request>"},
+		{"content type", svc.ContentType, "text/xml"},
+		{"reporting name", svc.ReportingName, "Svc"},
+		{"form", form.Form, []dumpParam{{"user", "bob", true},
+			{"__VIEWSTATE", "{{$HIDDEN1.__VIEWSTATE}}", true}}},
+		{"files", form.Files, []dumpFile{{"file", "a.txt", "text/plain"}}},
+		{"record result", form.RecordResult, "False"},
+		{"context parameters", doc.ContextParameters,
+			map[string]string{"WebServer1": "http://web01.example.com"}},
+		{"data source", doc.DataSources[0].Tables[0].Name, "text#csv"},
+		{"validation rule", doc.ValidationRules[0].Name, "Response URL"},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestDumpRawForms(t *testing.T) {
+	dir := writeRawRules(t, map[string]string{"sample.rawrule": `rules:
+  - regexp: 'Bearer \w+'
+    replace: 'Bearer {{Token}}'
+    scope: [header]
+  - regexp: '\d+/\d+/2016'
+    replace: '{{Date}}'
+    scope: [query]
+`})
+	defer os.RemoveAll(dir)
+	opt := DumpOptions{Raw: true, RawRule: filepath.Join(dir, "sample.rawrule")}
+	text := string(dumpSample(t, opt))
+	opt.Format = "json"
+	var doc dumpDocument
+	if err := json.Unmarshal(dumpSample(t, opt), &doc); err != nil {
+		t.Fatal(err)
+	}
+	login := doc.Requests[0]
+
+	tests := []struct {
+		name, want    string
+		got, wantJson interface{}
+	}{
+		{"header", `    H: <Header Name="Authorization" Value="Bearer {{Token}}&quot;def" />` + "\r\n",
+			login.Headers, []dumpHeader{{"Authorization", `Bearer {{Token}}"def`}}},
+		{"query", `Name="d" Value="{{Date}}"`,
+			login.Query[1], dumpParam{"d", "{{Date}}", true}},
+		{"think time", "G: (0,0) ", login.ThinkTime + "," + login.Timeout, "0,0"},
+	}
+	for _, tt := range tests {
+		if !strings.Contains(text, tt.want) {
+			t.Errorf("%s: no %q in text\n%s", tt.name, tt.want, text)
+		}
+		if !reflect.DeepEqual(tt.got, tt.wantJson) {
+			t.Errorf("%s: json %#v, want %#v", tt.name, tt.got, tt.wantJson)
+		}
+	}
+	if strings.Contains(text, "Bearer abc") {
+		t.Errorf("header not normalized in text\n%s", text)
+	}
+}
@@ -0,0 +1,801 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-dump
+// Purpose: wts (web test script) dump handling
+// authors: Antonio Sun (c) 2015-16, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+import (
+	"github.com/AntonioSun/shaper"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Extending shaper.Shaper
+type Shaper struct {
+	*shaper.Shaper
+}
+
+// Make a new Shaper filter and start adding bits
+func NewFilter() *Shaper {
+	//return &Shaper{ShaperStack: PassThrough}
+	return &Shaper{Shaper: shaper.NewFilter()}
+}
+
+func (me *Shaper) ApplyXMLDecode() *Shaper {
+	me.AddFilter(html.UnescapeString)
+	return me
+}
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// DumpOptions are the settings of a Dumper
+type DumpOptions struct {
+	Asis      bool   // output StringBody as-is, no XML decoding
+	Cnr       bool   // comment number removal
+	Tsr       bool   // time string removal
+	Raw       bool   // raw mode, will enable Cnr as well
+	RawRule   string // the .rawrule file, instead of the one of the script
+	Format    string // text (the default), json or yaml
+	KeepGoing bool   // report all the problems, not just the first
+}
+
+type current struct {
+	transaction string // the path of the transactions, outer/inner
+	comment     string
+}
+
+// Settings are the WebTest root attributes shown in the header
+// block of the dump, the WT: line
+type Settings struct {
+	XMLName            xml.Name `xml:"WebTest" json:"-" yaml:"-"`
+	Name               string   `xml:"Name,attr" json:"name" yaml:"name"`
+	Owner              string   `xml:"Owner,attr" json:"owner" yaml:"owner"`
+	Priority           string   `xml:"Priority,attr" json:"priority" yaml:"priority"`
+	Enabled            string   `xml:"Enabled,attr" json:"enabled" yaml:"enabled"`
+	Description        string   `xml:"Description,attr" json:"description" yaml:"description"`
+	CredentialUserName string   `xml:"CredentialUserName,attr" json:"credential_user_name" yaml:"credential_user_name"`
+	CredentialPassword string   `xml:"CredentialPassword,attr" json:"credential_password" yaml:"credential_password"`
+	PreAuthenticate    string   `xml:"PreAuthenticate,attr" json:"pre_authenticate" yaml:"pre_authenticate"`
+	Proxy              string   `xml:"Proxy,attr" json:"proxy" yaml:"proxy"`
+	StopOnError        string   `xml:"StopOnError,attr" json:"stop_on_error" yaml:"stop_on_error"`
+}
+
+// SecretMask is shown instead of a plain-text CredentialPassword
+const SecretMask = "***"
+
+// StdinName is how the web test script read from stdin is called
+const StdinName = "<stdin>"
+
+// Dumper dumps, or checks, one web test script. Each script gets its own
+// Dumper, so that the scripts can be processed concurrently
+type Dumper struct {
+	opt       DumpOptions
+	script    string
+	checkOnly bool
+	out       io.Writer // where the check findings go
+
+	stringBodyDump *Shaper
+	urlFix         *shaper.Shaper
+	cmtRe          *regexp.Regexp
+	tmsRe          *regexp.Regexp
+	dateCol        map[string]int // date string collection
+	raw            *rawState      // the .rawrule rules, in raw mode
+	doc            *dumpDocument  // the structured dump, for json or yaml
+	lint           *lintState
+	in             *xmlInput // the input being dumped, for the positions
+}
+
+// dumpState is the progress of dumping the items of one web test
+type dumpState struct {
+	w     *nestWriter
+	trans []string // the open transactions, outer first
+	cur   current
+	errs  ErrorList
+}
+
+// nestWriter indents the lines written to it by the nesting depth
+type nestWriter struct {
+	w       io.Writer
+	depth   int
+	midLine bool
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Script-wide processing
+
+// treatWtsXml dumps the web test parsed from the input, in the order its
+// parts are laid out, but the header block of the WebTest settings and
+// plugins goes first, though the plugins come last in the web test
+func (dp *Dumper) treatWtsXml(wo io.Writer, in *xmlInput) error {
+	wt, errs := parseInput(in, dp.opt.KeepGoing)
+	if wt == nil {
+		if len(errs) == 1 {
+			return errs[0]
+		}
+		return errs
+	}
+	dp.in = in
+
+	var head, body bytes.Buffer
+	defer func() {
+		if head.Len() != 0 {
+			head.WriteString("\r\n")
+		}
+		wo.Write(head.Bytes())
+		wo.Write(body.Bytes())
+	}()
+
+	s := newWebTestSettings(wt)
+	fmt.Fprintf(&head, "WT: %s\r\n", InlineXml(s))
+	if dp.doc != nil {
+		dp.doc.Settings = &s
+	}
+	if dp.checkOnly {
+		if found := dp.lint.webTest(s); len(found) != 0 {
+			printFindings(dp.out, found)
+			fmt.Fprintf(dp.out, "WT: %s\r\n\r\n", InlineXml(s))
+		}
+	}
+	for _, r := range wt.WebTestPlugins {
+		fmt.Fprintf(&head, "WP: (%s) %s\r\n",
+			r.DisplayName, InlineXml(r.RuleParameters))
+		if dp.doc != nil {
+			dp.doc.Plugins = append(dp.doc.Plugins,
+				dumpRule{Name: r.DisplayName,
+					Parameters: ruleParams(r.RuleParameters)})
+		}
+	}
+
+	// the items that failed to decode are left out, with their errors
+	ds := &dumpState{w: &nestWriter{w: &body}, errs: errs}
+	if !dp.treatItems(ds, wt.Items, 0) {
+		// stopped at the first error
+		return ds.errs[0]
+	}
+	w := ds.w
+	w.depth = 0
+	for _, r := range wt.DataSources {
+		fmt.Fprintf(w, "DS: (%s, %s) %s\r\n",
+			r.Name, r.Connection, InlineXml(r.Tables))
+		dp.dumpSource(r)
+	}
+	for _, r := range wt.ContextParameters {
+		fmt.Fprintf(w, "CP: %s=%s\r\n", r.Name, r.Value)
+		if dp.doc != nil {
+			dp.doc.ContextParameters[r.Name] = r.Value
+		}
+	}
+	for _, v := range wt.ValidationRules {
+		fmt.Fprintf(w, "VR: (%s) %s\r\n",
+			v.DisplayName, InlineXml(v.RuleParameters))
+		if dp.doc != nil {
+			dp.doc.ValidationRules = append(dp.doc.ValidationRules,
+				dumpRule{Name: v.DisplayName,
+					Parameters: ruleParams(v.RuleParameters)})
+		}
+	}
+
+	if dp.opt.Tsr {
+		// list of all date time strings used in the script in sorted order
+		var keys []string
+		for k := range dp.dateCol {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			fmt.Fprintf(w, "TS: %s: %d\n", k, dp.dateCol[k])
+		}
+	}
+
+	switch len(ds.errs) {
+	case 0:
+		return nil
+	case 1:
+		return ds.errs[0]
+	}
+	sortErrors(ds.errs)
+	return ds.errs
+}
+
+// treatItems dumps the items at the nesting depth, the Conditions, Loops
+// and TransactionTimers with their begin and end markers. It tells
+// whether to go on, i.e., no error found or in --keep-going mode
+func (dp *Dumper) treatItems(ds *dumpState, items Items, depth int) bool {
+	w := ds.w
+	// failed records the error of the element whose start tag ends at the
+	// offset, and tells whether to stop
+	failed := func(end int64, msg string, err error) bool {
+		ds.errs = append(ds.errs, dp.in.elementError(end, msg, err))
+		return !dp.opt.KeepGoing
+	}
+	for _, item := range items {
+		w.depth = depth
+		switch v := item.(type) {
+		case *Comment:
+			ds.cur.comment = v.CommentText
+			dp.treatComment(w, ds.cur.comment)
+		case *Request:
+			dp.treatRequest(w, *v, ds.cur)
+		case *IncludedWebTest:
+			fmt.Fprintf(w, "I: %s\r\n", InlineXml(v))
+		case *TransactionTimer:
+			if len(v.Name) == 0 && failed(v.offset,
+				"bad <TransactionTimer> element", fmt.Errorf("no transaction Name")) {
+				return false
+			}
+			ds.trans = append(ds.trans, v.Name)
+			ds.cur.transaction = strings.Join(ds.trans, "/")
+			treatTransaction(w, v.Name)
+			if dp.checkOnly {
+				if found := dp.lint.transaction(v.Name); len(found) != 0 {
+					treatTransaction(dp.out, ds.cur.transaction)
+					printFindings(dp.out, found)
+				}
+			}
+			if !dp.treatItems(ds, v.Items, depth+1) {
+				return false
+			}
+			w.depth = depth
+			fmt.Fprintf(w, "TE: %s\r\n", v.Name)
+			ds.trans = ds.trans[:len(ds.trans)-1]
+			ds.cur.transaction = strings.Join(ds.trans, "/")
+		case *Loop:
+			dp.treatRule(w, "LP", v.ConditionalRule)
+			if !dp.treatItems(ds, v.Items, depth+1) {
+				return false
+			}
+			w.depth = depth
+			fmt.Fprintf(w, "LP: \r\n=>\r\n\r\n")
+		case *Condition:
+			dp.treatRule(w, "CB", v.ConditionalRule)
+			if v.Then != nil && !dp.treatItems(ds, v.Then.Items, depth+1) {
+				return false
+			}
+			// the Else marker is only shown for a non-empty Else
+			if v.Else != nil && len(v.Else.Items) != 0 {
+				w.depth = depth
+				fmt.Fprintf(w, "EL: \r\n")
+				if !dp.treatItems(ds, v.Else.Items, depth+1) {
+					return false
+				}
+			}
+			w.depth = depth
+			fmt.Fprintf(w, "CE: \r\n=>\r\n\r\n")
+		case *Node:
+			// the ConditionalRule is only for a Condition or Loop
+			if v.XMLName.Local == "ConditionalRule" && failed(v.offset,
+				"bad <ConditionalRule> element", fmt.Errorf("not in a Condition or Loop")) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// treatRule writes the begin marker of a Condition, CB, or a Loop, LP,
+// with its ConditionalRule
+func (dp *Dumper) treatRule(w io.Writer, tag string, r *ConditionalRule) {
+	if r == nil {
+		return
+	}
+	fmt.Fprintf(w, "\r\n<=\r\n%s: (%s) %s\r\n",
+		tag, r.DisplayName, InlineXml(r.RuleParameters))
+}
+
+// newWebTestSettings takes the settings from the WebTest root element,
+// masking the CredentialPassword unless it is a context parameter
+func newWebTestSettings(wt *WebTest) Settings {
+	s := Settings{Name: wt.Name, Owner: wt.Owner, Priority: wt.Priority,
+		Enabled: wt.Enabled, Description: wt.Description,
+		CredentialUserName: wt.CredentialUserName,
+		CredentialPassword: wt.CredentialPassword,
+		PreAuthenticate:    wt.PreAuthenticate, Proxy: wt.Proxy,
+		StopOnError: wt.StopOnError,
+	}
+	if plainTextSecret(s.CredentialPassword) {
+		s.CredentialPassword = SecretMask
+	}
+	return s
+}
+
+// plainTextSecret tells whether the secret is given as is, rather than as
+// a context parameter, e.g., {{Password}}
+func plainTextSecret(s string) bool {
+	return len(s) != 0 && !ctxParamRe.MatchString(s)
+}
+
+var ctxParamRe = regexp.MustCompile(`^\{\{[^{}]+\}\}$`)
+
+func (n *nestWriter) Write(p []byte) (int, error) {
+	indent := []byte(strings.Repeat("  ", n.depth))
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		// no trailing spaces on the empty lines
+		if !n.midLine && line[0] != '\r' && line[0] != '\n' {
+			buf.Write(indent)
+		}
+		buf.Write(line)
+		n.midLine = line[len(line)-1] != '\n'
+	}
+	_, err := n.w.Write(buf.Bytes())
+	return len(p), err
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Item-level processing
+
+func (dp *Dumper) treatComment(w io.Writer, v string) {
+	fmt.Fprintf(w, "C: %s\r\n", dp.comment(v))
+}
+
+// comment is the comment as the dump shows it, with its rules applied in
+// raw mode, and without the comment number with --cnr
+func (dp *Dumper) comment(v string) string {
+	if dp.opt.Raw {
+		v = dp.raw.apply("comment", v)
+	}
+	if dp.opt.Cnr {
+		v = dp.cmtRe.ReplaceAllString(v, "[]")
+	}
+	return v
+}
+
+func newUrlFix() *shaper.Shaper {
+	return shaper.NewFilter().ApplyRegexpReplaceAll(
+		`http.*\w+\.\w+\.com`, "{{Param_TestServer}}")
+}
+
+// rawUrl normalizes the request url in raw mode, replacing the test server
+// and the dynamic values extracted so far, then applying the url rules
+func (dp *Dumper) rawUrl(url string) string {
+	return dp.raw.apply("url", dp.urlFix.Process(dp.raw.value("url", url)))
+}
+
+// treatRequest will process requests of any method, like
+// <Request Method="GET", <Request Method="POST" or <Request Method="PUT"
+func (dp *Dumper) treatRequest(wi io.Writer, r Request, cur current) {
+	w := bytes.NewBuffer([]byte{})
+	dp.dealOneRequest(w, r, cur, 0)
+	w.Write([]byte("\r\n"))
+
+	if !dp.checkOnly {
+		wi.Write(w.Bytes())
+	}
+}
+
+// dealOneRequest writes the request, then its dependent requests, each
+// line of which prefixed with "  D: ", recursively. The depth is 0 for the
+// top-level requests
+func (dp *Dumper) dealOneRequest(w *bytes.Buffer, r Request, cur current,
+	depth int) {
+	if len(r.Method) == 0 {
+		// the Visual Studio default
+		r.Method = "GET"
+	}
+	stringBody := DecodeStringBody(r.StringBody())
+	coreService := ""
+	// r is a copy, normalized once for all the forms of the dump
+	if dp.opt.Raw {
+		r.ThinkTime = "0"
+		r.Timeout = "0"
+		r.Url = dp.rawUrl(r.Url)
+		dp.rawParams(&r)
+		if r.StringHttpBody != nil && r.Method != "GET" {
+			coreService = dp.raw.summarize.Process(stringBody)
+		}
+	}
+	//fmt.Fprintf(w,"R: %q\r\n", r)
+	switch r.Method {
+	case "GET":
+		fmt.Fprintf(w, "G: (%s,%s) %s (%s):%s\r\n",
+			r.ThinkTime, r.Timeout, r.Url, r.ReportingName, r.RecordResult)
+	case "POST":
+		fmt.Fprintf(w, "P: (%s,%s) %s %s (%s):%s\r\n", r.ThinkTime, r.Timeout,
+			r.Url, coreService, r.ReportingName, r.RecordResult)
+	default:
+		// PUT, DELETE, PATCH, HEAD, OPTIONS and custom methods
+		fmt.Fprintf(w, "M: %s (%s,%s) %s %s (%s):%s\r\n", r.Method,
+			r.ThinkTime, r.Timeout, r.Url, coreService, r.ReportingName,
+			r.RecordResult)
+	}
+	body, bodyTags := "", ""
+	if r.StringHttpBody != nil {
+		shown := dp.stringBodyDump.Process(stringBody)
+		body = dp.dealRequest("body", shown)
+		lines, eol := bodyLines(body)
+		w.WriteString(lines)
+		bodyTags = bomTag(r.StringHttpBody.InsertByteOrderMark)
+		if eol == "\n" {
+			bodyTags += " LF"
+		}
+		if shown != stringBody {
+			// can't be built back, dump --asis for that
+			bodyTags += " decoded"
+		}
+	}
+	dp.dealReqAddons(w, r, bodyTags)
+	dp.dumpRecord(r, cur, coreService, body, depth)
+	dp.checkRequest(r, w, cur, depth)
+
+	for _, d := range r.DependentRequests {
+		dw := bytes.NewBuffer([]byte{})
+		dp.dealOneRequest(dw, *d, cur, depth+1)
+		w.WriteString(dependentLines(dw.String()))
+	}
+}
+
+// dependentLines prefixes the lines of a dependent request with "  D: "
+func dependentLines(s string) string {
+	lines := strings.SplitAfter(s, "\r\n")
+	for i, l := range lines {
+		if len(l) != 0 {
+			lines[i] = "  D: " + l
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+func treatTransaction(w io.Writer, v string) {
+	fmt.Fprintf(w, "\r\nT: %s\r\n", v)
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Request specific processing
+
+// dealReqAddons writes the addon lines of the request. The bodyTags tell
+// how its StringBody is shown
+func (dp *Dumper) dealReqAddons(w io.Writer, r Request, bodyTags string) {
+	if r.StringHttpBody != nil {
+		fmt.Fprintf(w, "  S: (%s)%s\r\n", r.StringHttpBody.ContentType,
+			bodyTags)
+	}
+	if r.BinaryHttpBody != nil {
+		fmt.Fprintf(w, "  B: (%s) %s\r\n",
+			r.BinaryHttpBody.ContentType, r.BinaryHttpBody.Data)
+	}
+	if attrs := requestAttrs(r); len(attrs) != 0 {
+		fmt.Fprintf(w, "  A: %s\r\n", attrs)
+	}
+	if len(r.Headers) != 0 {
+		prefixTag := "  H: "
+		split := shaper.NewFilter().ApplyRegexpReplaceAll(
+			`( />)(<)`, "$1\r\n"+prefixTag+"$2")
+		fmt.Fprintf(w, "%s%s\r\n", prefixTag,
+			split.Process(InlineXml(r.Headers)))
+	}
+	if len(r.QueryStringParameters) != 0 {
+		prefixTag := "  Q: "
+		split := shaper.NewFilter().ApplyRegexpReplaceAll(
+			`( />)(<)`, "$1\r\n"+prefixTag+"$2")
+		fmt.Fprintf(w, "%s%s\r\n", prefixTag,
+			split.Process(InlineXml(r.QueryStringParameters)))
+	}
+	if r.FormPostHttpBody != nil {
+		fmt.Fprintf(w, "  F: %s%s\r\n",
+			InlineXml(r.FormPostHttpBody.FormPostParameter),
+			InlineXml(r.FormPostHttpBody.FileUploadParameter))
+	}
+	for _, v := range r.RequestPlugins {
+		fmt.Fprintf(w, "  R: (%s) %s\r\n",
+			v.DisplayName, InlineXml(v.RuleParameters))
+	}
+	for _, v := range r.ExtractionRules {
+		fmt.Fprintf(w, "  E: (%s: %s) %s\r\n",
+			v.DisplayName, v.VariableName, InlineXml(v.RuleParameters))
+	}
+	for _, v := range r.ValidationRules {
+		fmt.Fprintf(w, "  V: (%s) %s\r\n",
+			v.DisplayName, InlineXml(v.RuleParameters))
+	}
+}
+
+// bomTag shows the InsertByteOrderMark of the StringHttpBody when it is set
+func bomTag(insert string) string {
+	if insert == "True" {
+		return " BOM"
+	}
+	return ""
+}
+
+// bodyLines shows the StringBody as a block of lines, each prefixed with
+// "  |", so that the empty lines in it do not end the request. The body is
+// split by its line ending, CRLF unless it has bare LF ones, which is
+// returned as well for the S: line to tell
+func bodyLines(body string) (string, string) {
+	eol := "\r\n"
+	if strings.Count(body, "\n") != strings.Count(body, "\r\n") {
+		eol = "\n"
+	}
+	var buf bytes.Buffer
+	for _, l := range strings.Split(body, eol) {
+		if len(l) == 0 {
+			buf.WriteString("  |\r\n")
+			continue
+		}
+		buf.WriteString("  | " + l + "\r\n")
+	}
+	return buf.String(), eol
+}
+
+// requestAttrs lists the attributes of the request, as in the XML, which
+// the request line does not show and are not the Visual Studio defaults.
+// The default ones that the request does not have are listed as empty
+func requestAttrs(r Request) string {
+	d := NewRequest()
+	d.Method, d.Guid, d.Url, d.ThinkTime, d.Timeout, d.ReportingName,
+		d.RecordResult = r.Method, r.Guid, r.Url, r.ThinkTime, r.Timeout,
+		r.ReportingName, r.RecordResult
+	attrs, defaults := requestShellAttrs(r), requestShellAttrs(*d)
+	values := map[string]string{}
+	for _, a := range attrs {
+		values[a.Name.Local] = a.Value
+	}
+
+	var buf bytes.Buffer
+	show := func(name, value string) {
+		if buf.Len() != 0 {
+			buf.WriteString(" ")
+		}
+		buf.WriteString(name + `="` + xmlAttrEscaper.Replace(value) + `"`)
+	}
+	for _, a := range attrs {
+		if v, found := attrLookup(defaults, a.Name.Local); !found || v != a.Value {
+			show(a.Name.Local, a.Value)
+		}
+	}
+	for _, a := range defaults {
+		if _, found := values[a.Name.Local]; !found {
+			show(a.Name.Local, "")
+		}
+	}
+	return buf.String()
+}
+
+// requestShellAttrs are the attributes of the Request element as encoded
+func requestShellAttrs(r Request) []xml.Attr {
+	r.Headers, r.RequestPlugins, r.DependentRequests = nil, nil, nil
+	r.ExtractionRules, r.CorrelationExtractionRules = nil, nil
+	r.ValidationRules, r.QueryStringParameters = nil, nil
+	r.FormPostHttpBody, r.StringHttpBody, r.BinaryHttpBody = nil, nil, nil
+	r.Unknown = nil
+	nodes, err := encodeXmlNodes(xml.Name{Local: "Request"}, &r)
+	if err != nil || len(nodes) == 0 {
+		return nil
+	}
+	return nodes[0].attr
+}
+
+func attrLookup(attrs []xml.Attr, name string) (string, bool) {
+	for _, a := range attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// rawParams replaces the dynamic values in the headers, the query and form
+// parameters of the request, which is a copy, and applies their rules, in
+// raw mode. Their slices are copied, not to change the original request
+func (dp *Dumper) rawParams(r *Request) {
+	hs := make([]Header, len(r.Headers))
+	for i, v := range r.Headers {
+		v.Value = dp.raw.apply("header", dp.raw.value("header", v.Value))
+		hs[i] = v
+	}
+	r.Headers = hs
+	qs := make([]QueryStringParameter, len(r.QueryStringParameters))
+	for i, v := range r.QueryStringParameters {
+		v.Value = dp.raw.apply("query", dp.raw.value("query", v.Value))
+		qs[i] = v
+	}
+	r.QueryStringParameters = qs
+	if r.FormPostHttpBody != nil {
+		fp := *r.FormPostHttpBody
+		fp.FormPostParameter = make([]FormPostParameter, len(fp.FormPostParameter))
+		for i, v := range r.FormPostHttpBody.FormPostParameter {
+			v.Value = dp.raw.apply("form", dp.raw.value("form", v.Value))
+			fp.FormPostParameter[i] = v
+		}
+		r.FormPostHttpBody = &fp
+	}
+}
+
+// dealRequest
+// a filter to deal with POST StringBody and GET QueryStringParameters
+// Functionality:
+//   - extract and replace the dynamic values of the scope, and apply the
+//     .rawrule rules of the scope, in raw mode
+//   - collect and replace date strings
+func (dp *Dumper) dealRequest(scope, v string) string {
+	if dp.opt.Raw {
+		v = dp.raw.apply(scope, dp.raw.value(scope, v))
+	}
+
+	if !dp.opt.Tsr {
+		return v
+	}
+
+	for _, m := range dp.tmsRe.FindAllString(v, -1) {
+		//debug(m, 1)
+		dp.dateCol[m]++
+	}
+	v = dp.tmsRe.ReplaceAllString(v, "-time-string-")
+	return v
+}
+
+// checkRequest lints the request, a dependent one if depth > 0, and shows
+// it with its findings, if any
+func (dp *Dumper) checkRequest(r Request, buf *bytes.Buffer, cur current,
+	depth int) {
+	if !dp.checkOnly {
+		return
+	}
+	reqs := buf.String()
+	line, _ := dp.in.position(r.offset)
+	if found := dp.lint.request(r, reqs, cur, depth > 0, line); len(found) != 0 {
+		treatTransaction(dp.out, cur.transaction)
+		dp.treatComment(dp.out, cur.comment)
+		printFindings(dp.out, found)
+		for i := 0; i < depth; i++ {
+			reqs = dependentLines(reqs)
+		}
+		fmt.Fprint(dp.out, reqs+"\r\n")
+	}
+}
+
+// StringBody returns the raw (base64 encoded) StringHttpBody of the request
+func (r *Request) StringBody() string {
+	if r.StringHttpBody == nil {
+		return ""
+	}
+	return r.StringHttpBody.Body
+}
+
+func DecodeStringBody(s string) string {
+	uDec, _ := base64.StdEncoding.DecodeString(s)
+	return DecodeUTF16(uDec)
+}
+
+func DecodeUTF16(s []byte) string {
+	u16s := make([]uint16, len(s)/2)
+	for i := range u16s {
+		u16s[i] = binary.LittleEndian.Uint16([]byte(s[i*2:]))
+	}
+
+	return string(utf16.Decode(u16s))
+}
+
+// EncodeStringBody is the reverse of DecodeStringBody
+func EncodeStringBody(s string) string {
+	return base64.StdEncoding.EncodeToString(EncodeUTF16(s))
+}
+
+func EncodeUTF16(s string) []byte {
+	u16s := utf16.Encode([]rune(s))
+	b := make([]byte, len(u16s)*2)
+	for i, u := range u16s {
+		binary.LittleEndian.PutUint16(b[i*2:], u)
+	}
+	return b
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Main dispatch functions
+
+// NewDumper prepares the filters according to the opt settings, for the
+// given web test script, whose .rawrule file is used in raw mode. It is
+// opt.RawRule, which must exist, or else the one next to the script if
+// there is, but none for the script read from stdin, the StdinName
+func NewDumper(script string, opt DumpOptions) (*Dumper, error) {
+	dp := &Dumper{opt: opt, script: script, out: ioutil.Discard,
+		stringBodyDump: NewFilter(), urlFix: newUrlFix(),
+		dateCol: map[string]int{}}
+
+	if !dp.opt.Asis {
+		dp.stringBodyDump.ApplyXMLDecode()
+	}
+	if dp.opt.Raw {
+		dp.opt.Cnr = true
+		rawRule, optional := dp.opt.RawRule, false
+		if len(rawRule) == 0 && script != StdinName {
+			rawRule = strings.TrimSuffix(script, filepath.Ext(script)) + ".rawrule"
+			optional = true
+		}
+		raw, err := rawRuleRead(rawRule, optional)
+		if err != nil {
+			return nil, err
+		}
+		dp.raw = raw
+	}
+	if dp.opt.Cnr {
+		dp.cmtRe = regexp.MustCompile(`\[#\d+]`)
+	}
+	if dp.opt.Tsr {
+		dp.tmsRe = regexp.MustCompile(`(20\d{2}-\d{1,2}-\d{1,2}[T0-9:.]*|\d{1,2}/\d{1,2}/20\d{2})`)
+	}
+	return dp, nil
+}
+
+// Dump reads the web test script from r and writes its dump to w, in the
+// text, json or yaml format
+func (dp *Dumper) Dump(w io.Writer, r io.Reader) error {
+	decoder, err := dp.decoder(r)
+	if err != nil {
+		return err
+	}
+	switch dp.opt.Format {
+	case "", "text":
+		return dp.treatWtsXml(w, decoder)
+	case "json", "yaml":
+		return dp.dumpStructured(w, decoder)
+	}
+	return fmt.Errorf("unknown dump format '%s'", dp.opt.Format)
+}
+
+func (dp *Dumper) decoder(r io.Reader) (*xmlInput, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return newXmlInput(dp.script, content), nil
+}
+
+// Url is the request url as the dump shows it, normalized in raw mode
+func (dp *Dumper) Url(url string) string {
+	if !dp.opt.Raw {
+		return url
+	}
+	return dp.rawUrl(url)
+}
+
+// Value is the value of the scope as the dump shows it, i.e., with the
+// .rawrule rules of the scope applied in raw mode, and the time strings
+// replaced with --tsr. The scope is url, header, query, form, body or
+// comment
+func (dp *Dumper) Value(scope, v string) string {
+	return dp.dealRequest(scope, v)
+}
+
+// Body is the StringHttpBody of the request as the dump shows it
+func (dp *Dumper) Body(r *Request) string {
+	return dp.dealRequest("body",
+		dp.stringBodyDump.Process(DecodeStringBody(r.StringBody())))
+}
+
+// RawRule is the .rawrule file used in raw mode, empty if none
+func (dp *Dumper) RawRule() string {
+	if dp.raw == nil {
+		return ""
+	}
+	return dp.raw.file
+}
+
+// Reset forgets the dynamic values found so far, before the next script
+func (dp *Dumper) Reset() {
+	if dp.raw != nil {
+		dp.raw.reset()
+	}
+}
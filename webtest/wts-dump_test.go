@@ -0,0 +1,372 @@
+package webtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// dumpString dumps the web test content with the options
+func dumpString(t *testing.T, content []byte, opt DumpOptions) (string, error) {
+	dp, err := NewDumper("T.webtest", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = dp.Dump(&buf, bytes.NewReader(content))
+	return buf.String(), err
+}
+
+func TestDumpEncodings(t *testing.T) {
+	sample := readSample(t)
+	want, err := dumpString(t, sample, DumpOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	latin1 := []byte("<?xml version=\"1.0\" encoding=\"iso-8859-1\"?>\r\n" +
+		"<WebTest Name=\"Caf\xe9\"><Items><Comment CommentText=\"na\xefve\" /></Items></WebTest>")
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"UTF-8 BOM", append([]byte{0xEF, 0xBB, 0xBF}, sample...), want},
+		{"UTF-16LE", toUtf16(sample, binary.LittleEndian, true), want},
+		{"UTF-16BE", toUtf16(sample, binary.BigEndian, true), want},
+		{"UTF-16LE without BOM", toUtf16(sample, binary.LittleEndian, false), want},
+		{"UTF-16BE without BOM", toUtf16(sample, binary.BigEndian, false), want},
+		{"Latin-1", latin1, "C: naïve\r\n"},
+		{"Windows-1252", bytes.Replace(latin1, []byte("iso-8859-1"), []byte("windows-1252"), 1),
+			"C: naïve\r\n"},
+		{"Windows-1252 only characters", []byte("<?xml version=\"1.0\" encoding=\"Windows-1252\"?>\r\n" +
+			"<WebTest Name=\"T\"><Items><Comment CommentText=\"\x935 \x80\x94 caf\xe9\" /></Items></WebTest>"),
+			"C: \u201c5 \u20ac\u201d café\r\n"},
+		{"cp1252", []byte("<?xml version=\"1.0\" encoding=\"cp1252\"?>\r\n" +
+			"<WebTest Name=\"T\"><Items><Comment CommentText=\"\x80\" /></Items></WebTest>"),
+			"C: \u20ac\r\n"},
+	}
+	for _, tt := range tests {
+		got, err := dumpString(t, tt.content, DumpOptions{})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if !strings.Contains(got, tt.want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	_, err = dumpString(t, []byte(`<?xml version="1.0" encoding="ebcdic"?><WebTest />`),
+		DumpOptions{})
+	if err == nil || !strings.Contains(err.Error(), "unsupported encoding 'ebcdic'") {
+		t.Errorf("error %v, want unsupported encoding", err)
+	}
+}
+
+func TestDumpErrors(t *testing.T) {
+	source := `<WebTest Name="T">
+  <Items>
+    <Comment CommentText="a" />
+    <TransactionTimer><Items /></TransactionTimer>
+    <ConditionalRule />
+    <Request Method="GET" Url="u2" />
+  </Items>
+</WebTest>`
+	tests := []struct {
+		name      string
+		source    string
+		keepGoing bool
+		errs      string
+		dumped    string
+	}{
+		{"first only", source, false,
+			"T.webtest:4:5: bad <TransactionTimer> element: no transaction Name",
+			"C: a\r\n"},
+		{"keep going", source, true,
+			"T.webtest:4:5: bad <TransactionTimer> element: no transaction Name\n" +
+				"T.webtest:5:5: bad <ConditionalRule> element: not in a Condition or Loop",
+			"C: a\r\n\r\nT: \r\nTE: \r\nG: (,) u2 ():\r\n"},
+		{"malformed", strings.Replace(source, "/>\n  </Items>", "><Bad></Request>\n  </Items>", 1),
+			true, "T.webtest:4:5: bad <TransactionTimer> element: no transaction Name\n" +
+				"T.webtest:5:5: bad <ConditionalRule> element: not in a Condition or Loop\n" +
+				"T.webtest:6:52: bad <Request> element: malformed XML, element <Bad> closed by </Request>",
+			"C: a\r\n\r\nT: \r\nTE: \r\n"},
+		{"malformed, first only", strings.Replace(source, "/>\n  </Items>", "><Bad></Request>\n  </Items>", 1),
+			false, "T.webtest:6:52: bad <Request> element: malformed XML, element <Bad> closed by </Request>", ""},
+		{"bad entity", `<WebTest><Items>` + "\n" +
+			`<Request Method="GET" Url="&bad;" /><Comment CommentText="b" /></Items></WebTest>`, true,
+			"T.webtest:2:33: bad <Request> element: malformed XML, invalid character entity &bad;",
+			"C: b\r\n"},
+		{"bad items, nested", `<WebTest><Items>` + "\n" +
+			`<TransactionTimer Name="t"><Items><Request Url="&bad;" /></Items></TransactionTimer>` + "\n" +
+			`<Request Url="u1"><Headers><Header Name="&bad;" /></Headers></Request>` + "\n" +
+			`<Request Url="u2" /></Items></WebTest>`, true,
+			"T.webtest:2:54: bad <Request> element: malformed XML, invalid character entity &bad;\n" +
+				"T.webtest:3:47: bad <Request> element: malformed XML, invalid character entity &bad;",
+			"T: t\r\nTE: t\r\nG: (,) u2 ():\r\n"},
+		{"truncated", "<WebTest>\n<Items>\n<Request Url=\"u\"", true,
+			"T.webtest:3:17: bad <Request> element: malformed XML, unexpected EOF", ""},
+		{"Latin-1 position", "<?xml version=\"1.0\" encoding=\"iso-8859-1\"?>\r\n" +
+			"<WebTest><Items><Comment CommentText=\"caf\xe9\" /><Request Url=\"&bad;\" /></Items></WebTest>", true,
+			"T.webtest:2:66: bad <Request> element: malformed XML, invalid character entity &bad;",
+			"C: café\r\n"},
+		{"UTF-16 position", string(toUtf16([]byte("<?xml version=\"1.0\" encoding=\"utf-16\"?>\r\n"+
+			"<WebTest><Items><Comment CommentText=\"\u20ac\" /><Request Url=\"&bad;\" /></Items></WebTest>"),
+			binary.LittleEndian, true)), true,
+			"T.webtest:2:63: bad <Request> element: malformed XML, invalid character entity &bad;",
+			"C: \u20ac\r\n"},
+		{"not a web test", "<?xml version=\"1.0\"?>\r\n<Project />", true,
+			"T.webtest:2:1: reading the web test: not a web test, root element is <Project>", ""},
+		{"no root", "", true, "T.webtest:1:1: reading the web test: no root element", ""},
+	}
+	for _, tt := range tests {
+		got, err := dumpString(t, []byte(tt.source), DumpOptions{KeepGoing: tt.keepGoing})
+		if err == nil || err.Error() != tt.errs {
+			t.Errorf("%s: error\n%v\nwant\n%s", tt.name, err, tt.errs)
+		}
+		if !strings.Contains(got, tt.dumped) {
+			t.Errorf("%s: dumped\n%s\nwant\n%s", tt.name, got, tt.dumped)
+		}
+	}
+}
+
+// webTestOf wraps the items into a web test
+func webTestOf(items string) []byte {
+	return []byte(`<WebTest Name="T"><Items>` + items + `</Items></WebTest>`)
+}
+
+func TestDumpMethods(t *testing.T) {
+	body := `<StringHttpBody ContentType="application/json">` +
+		EncodeStringBody(`{"a":1}`) + `</StringHttpBody>`
+	form := `<FormPostHttpBody><FormPostParameter Name="u" Value="b" UrlEncode="True" />` +
+		`<FileUploadParameter Name="file" FileName="a.txt" ContentType="text/plain" />` +
+		`</FormPostHttpBody>`
+	tests := []struct {
+		name, request, want, method string
+	}{
+		{"GET by default", `<Request Guid="g" Url="http://a/" />`,
+			"G: (,) http://a/ ():\r\n", "GET"},
+		{"attributes in any order", `<Request Url="http://a/" Guid="g" ThinkTime="1" Method="POST" />`,
+			"P: (1,) http://a/  ():\r\n", "POST"},
+		{"PUT with a string body", `<Request Method="PUT" Url="http://a/x">` + body + `</Request>`,
+			"M: PUT (,) http://a/x  ():\r\n  | {\"a\":1}\r\n  S: (application/json)\r\n", "PUT"},
+		{"DELETE", `<Request Method="DELETE" Url="http://a/x/1" />`,
+			"M: DELETE (,) http://a/x/1  ():\r\n", "DELETE"},
+		{"PATCH with a binary body", `<Request Method="PATCH" Url="http://a/x/1">` +
+			`<BinaryHttpBody ContentType="application/octet-stream">AAEC</BinaryHttpBody></Request>`,
+			"M: PATCH (,) http://a/x/1  ():\r\n  B: (application/octet-stream) AAEC\r\n", "PATCH"},
+		{"HEAD", `<Request Method="HEAD" Url="http://a/" />`, "M: HEAD (,) http://a/  ():\r\n", "HEAD"},
+		{"OPTIONS", `<Request Method="OPTIONS" Url="http://a/" />`, "M: OPTIONS (,) http://a/  ():\r\n", "OPTIONS"},
+		{"custom method", `<Request Method="PROPFIND" Url="http://a/d" />`,
+			"M: PROPFIND (,) http://a/d  ():\r\n", "PROPFIND"},
+		{"form post and file upload", `<Request Method="POST" Url="http://a/f">` + form + `</Request>`,
+			`  F: <FormPostParameter Name="u" Value="b" RecordedValue="" CorrelationBinding="" UrlEncode="True" />` +
+				`<FileUploadParameter Name="file" FileName="a.txt" ContentType="text/plain" />` + "\r\n",
+			"POST"},
+	}
+	for _, tt := range tests {
+		got, err := dumpString(t, webTestOf(tt.request), DumpOptions{})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if !strings.Contains(got, tt.want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+
+		got, err = dumpString(t, webTestOf(tt.request), DumpOptions{Format: "json"})
+		if err != nil {
+			t.Errorf("%s: json: %v", tt.name, err)
+		} else if !strings.Contains(got, `"method": "`+tt.method+`"`) {
+			t.Errorf("%s: json method not %s:\n%s", tt.name, tt.method, got)
+		}
+	}
+
+	got, err := dumpString(t, webTestOf(`<Request Method="POST" Url="http://a/f">`+form+
+		`</Request><Request Method="PATCH" Url="http://a/x"><BinaryHttpBody ContentType="c">AAEC</BinaryHttpBody></Request>`),
+		DumpOptions{Format: "json"})
+	for _, want := range []string{`"form": [`, `"name": "u"`, `"url_encode": true`,
+		`"files": [`, `"file_name": "a.txt"`, `"data": "AAEC"`} {
+		if err != nil || !strings.Contains(got, want) {
+			t.Errorf("json: no %s in\n%s (%v)", want, got, err)
+		}
+	}
+}
+
+func TestDumpDependents(t *testing.T) {
+	source := webTestOf(`<Request Url="http://a/p1" ThinkTime="0"><DependentRequests>` +
+		`<Request Url="http://a/d1" ThinkTime="0"><DependentRequests>` +
+		`<Request Url="http://a/d11" ThinkTime="5" /></DependentRequests></Request>` +
+		`<Request Url="http://a/d2" ThinkTime="0" /></DependentRequests></Request>` +
+		`<Request Url="http://a/p2" ThinkTime="5" />`)
+	got, err := dumpString(t, source, DumpOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"G: (0,) http://a/p1 ():\r\n",
+		"  D: G: (0,) http://a/d1 ():\r\n",
+		"  D:   D: G: (5,) http://a/d11 ():\r\n",
+		"  D: G: (0,) http://a/d2 ():\r\n",
+		"\r\nG: (5,) http://a/p2 ():\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("no %q in\n%s", want, got)
+		}
+	}
+
+	var doc dumpDocument
+	got, _ = dumpString(t, source, DumpOptions{Format: "json"})
+	if err := json.Unmarshal([]byte(got), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Requests) != 2 || len(doc.Requests[0].Dependents) != 2 ||
+		doc.Requests[0].Dependents[0].Dependents[0].Url != "http://a/d11" ||
+		doc.Requests[0].Dependents[1].Url != "http://a/d2" {
+		t.Errorf("dependents not nested:\n%s", got)
+	}
+
+	c, err := NewChecker(CheckOptions{Timeout: 270})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Check("T.webtest", bytes.NewReader(source), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Requests != 2 || res.DependentRequests != 3 {
+		t.Errorf("%d requests, %d dependent ones", res.Requests, res.DependentRequests)
+	}
+	var thinks []string
+	for _, f := range res.Findings {
+		if f.Rule == "think-time" {
+			thinks = append(thinks, fmt.Sprintf("%d.%d %s", f.Request, f.Dependent, f.Url))
+		}
+	}
+	if want := "1.2 http://a/d11, 2.0 http://a/p2"; strings.Join(thinks, ", ") != want {
+		t.Errorf("think-time findings %q, want %q", thinks, want)
+	}
+}
+
+func TestDumpNesting(t *testing.T) {
+	source := webTestOf(`<TransactionTimer Name="Outer"><Items>` +
+		`<Condition UniqueStringId="c1"><ConditionalRule DisplayName="If" /><Then><Items>` +
+		`<Loop UniqueStringId="l1"><ConditionalRule DisplayName="For" /><Items>` +
+		`<TransactionTimer Name="Inner"><Items><Request Url="http://a/1" /></Items></TransactionTimer>` +
+		`</Items></Loop></Items></Then>` +
+		`<Else><Items><Request Url="http://a/2" /></Items></Else></Condition>` +
+		`<Request Url="http://a/3" /></Items></TransactionTimer>` +
+		`<Request Url="http://a/4" />`)
+	got, err := dumpString(t, source, DumpOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without the header and the A: lines
+	var lines []string
+	for _, l := range strings.Split(got, "\r\n")[2:] {
+		if !strings.HasPrefix(strings.TrimLeft(l, " "), "A: ") {
+			lines = append(lines, l)
+		}
+	}
+	want := `
+T: Outer
+
+  <=
+  CB: (If) 
+
+    <=
+    LP: (For) 
+
+      T: Inner
+        G: (,) http://a/1 ():
+
+      TE: Inner
+    LP: 
+    =>
+
+  EL: 
+    G: (,) http://a/2 ():
+
+  CE: 
+  =>
+
+  G: (,) http://a/3 ():
+
+TE: Outer
+G: (,) http://a/4 ():
+
+`
+	if got := strings.Join(lines, "\n"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	var doc dumpDocument
+	got, _ = dumpString(t, source, DumpOptions{Format: "json"})
+	if err := json.Unmarshal([]byte(got), &doc); err != nil {
+		t.Fatal(err)
+	}
+	res, err := checkWith(t, string(source), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{"Outer/Inner", "Outer", "Outer", ""}
+	if len(doc.Requests) != len(paths) || len(res.Findings) == 0 {
+		t.Fatalf("%d requests, %d findings", len(doc.Requests), len(res.Findings))
+	}
+	for i, r := range doc.Requests {
+		if r.Transaction != paths[i] {
+			t.Errorf("request %d: transaction %q, want %q", i+1, r.Transaction, paths[i])
+		}
+	}
+	for _, f := range res.Findings {
+		if f.Request != 0 && f.Transaction != paths[f.Request-1] {
+			t.Errorf("finding %+v: transaction not %q", f, paths[f.Request-1])
+		}
+	}
+}
+
+func TestDumpSettings(t *testing.T) {
+	plugins := `<WebTestPlugins><WebTestPlugin Classname="A" DisplayName="Auth">` +
+		`<RuleParameters><RuleParameter Name="User" Value="admin" /></RuleParameters>` +
+		`</WebTestPlugin><WebTestPlugin Classname="B" DisplayName="Log" /></WebTestPlugins>`
+	tests := []struct {
+		name, root, want, found string
+	}{
+		{"plain-text password masked", `Name="T" Owner="me" Priority="1" Enabled="True" ` +
+			`CredentialUserName="bob" CredentialPassword="secret" PreAuthenticate="True" ` +
+			`Proxy="default" StopOnError="False" Description="d"`,
+			`WT: <WebTest Name="T" Owner="me" Priority="1" Enabled="True" Description="d" ` +
+				`CredentialUserName="bob" CredentialPassword="` + SecretMask + `" PreAuthenticate="True" ` +
+				`Proxy="default" StopOnError="False" />` + "\r\n",
+			"stop-on-error plain-text-credentials"},
+		{"context parameter password kept", `Name="T" CredentialUserName="bob" ` +
+			`CredentialPassword="{{Password}}" StopOnError="True"`,
+			`CredentialPassword="{{Password}}" PreAuthenticate="" Proxy="" StopOnError="True" />` + "\r\n", ""},
+	}
+	for _, tt := range tests {
+		source := `<WebTest ` + tt.root + `><Items><Comment CommentText="c" /></Items>` +
+			plugins + `</WebTest>`
+		got, err := dumpString(t, []byte(source), DumpOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the header block goes first, though the plugins come last
+		head := "WP: (Auth) <RuleParameter Name=\"User\" Value=\"admin\" />\r\n" +
+			"WP: (Log) \r\n\r\nC: c\r\n"
+		if !strings.HasPrefix(got, "WT: ") || !strings.Contains(got, tt.want+head) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want+head)
+		}
+
+		res, err := checkWith(t, source, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rules []string
+		for _, f := range res.Findings {
+			rules = append(rules, f.Rule)
+		}
+		if got := strings.Join(rules, " "); got != tt.found {
+			t.Errorf("%s: findings %q, want %q", tt.name, got, tt.found)
+		}
+	}
+}
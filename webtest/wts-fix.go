@@ -0,0 +1,273 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-fix
+// Purpose: wts (web test script) fix handling
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// FixOptions tells the canonical values to fix the requests to
+type FixOptions struct {
+	ThinkTime int // the ThinkTime of all the requests
+	Timeout   int // the lowest Timeout, the lower ones are raised to it
+}
+
+// fixPatch replaces the bytes of an attribute value, from start to end,
+// within the script text, or adds the attribute where start == end
+type fixPatch struct {
+	start, end int
+	value      string
+}
+
+// diffContext is the number of unchanged lines around the changes in the
+// --dry-run diff
+const diffContext = 3
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// Fix fixes the ThinkTime and Timeout of all the requests of the web test
+// script source to the canonical values, reporting each fix to w. The
+// rest of the script is left as it is, and the fixed one is in the
+// encoding of the source. It tells the number of fixes too
+func Fix(w io.Writer, source []byte, opt FixOptions) ([]byte, int, error) {
+	// the script is fixed as UTF-8 text, then saved in its own encoding
+	text := ToUtf8(source)
+	if _, err := Parse(bytes.NewReader(text)); err != nil {
+		return nil, 0, err
+	}
+	patches, err := fixRequests(w, text, opt)
+	if err != nil || len(patches) == 0 {
+		return source, 0, err
+	}
+	return fixEncoding(source, fixApply(text, patches)), len(patches), nil
+}
+
+// fixRequests finds the ThinkTime and Timeout of all the requests,
+// dependent requests included, that are not the canonical values the way
+// the check verb expects them, reports each to w and returns the patches
+// to fix them in place, leaving the rest of the script as it is
+func fixRequests(w io.Writer, text []byte, opt FixOptions) ([]fixPatch, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(text))
+	// the text is in UTF-8 already, whatever the XML declaration says
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var patches []fixPatch
+	var stack, trans []string
+	// the requests are numbered the way the check verb does, #n, or #n.d
+	// for the dth dependent request of the nth one
+	index, dep := 0, 0
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			parent := ""
+			if n := len(stack); n != 0 {
+				parent = stack[n-1]
+			}
+			stack = append(stack, t.Name.Local)
+			if t.Name.Local == "TransactionTimer" {
+				trans = append(trans, attrOf(t, "Name"))
+			}
+			if t.Name.Local != "Request" {
+				continue
+			}
+			if parent == "DependentRequests" {
+				dep++
+			} else {
+				index, dep = index+1, 0
+			}
+
+			tag := text[offset:decoder.InputOffset()]
+			fix := func(attr string, to int) {
+				from := attrOf(t, attr)
+				f := Finding{Request: index, Dependent: dep}
+				fmt.Fprintf(w, "%s [%s] %s: %s %s => %d\n", f.Where(),
+					strings.Join(trans, "/"), attrOf(t, "Url"), attr, from, to)
+				p := fixPatch{value: strconv.Itoa(to)}
+				if start, end := attrRange(tag, attr); start >= 0 {
+					p.start, p.end = start, end
+				} else {
+					// not there, added after the last attribute
+					p.start = attrEnd(tag)
+					p.end, p.value = p.start, fmt.Sprintf(` %s="%d"`, attr, to)
+				}
+				p.start += int(offset)
+				p.end += int(offset)
+				patches = append(patches, p)
+			}
+			// as numbers, a missing one is 0, like the check verb
+			if tt, _ := strconv.Atoi(attrOf(t, "ThinkTime")); tt != opt.ThinkTime {
+				fix("ThinkTime", opt.ThinkTime)
+			}
+			// only raise the Timeout, like the check verb
+			if to, _ := strconv.Atoi(attrOf(t, "Timeout")); to < opt.Timeout {
+				fix("Timeout", opt.Timeout)
+			}
+		case xml.EndElement:
+			if n := len(stack); n != 0 {
+				if stack[n-1] == "TransactionTimer" && len(trans) != 0 {
+					trans = trans[:len(trans)-1]
+				}
+				stack = stack[:n-1]
+			}
+		}
+	}
+	return patches, nil
+}
+
+func attrOf(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// attrRange tells where the value of the attribute is, within the quotes,
+// in the start tag, or -1 if it is not there
+func attrRange(tag []byte, name string) (int, int) {
+	re := regexp.MustCompile(`\s` + name + `\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	m := re.FindSubmatchIndex(tag)
+	switch {
+	case m == nil:
+		return -1, -1
+	case m[2] >= 0:
+		return m[2], m[3]
+	}
+	return m[4], m[5]
+}
+
+// attrEnd tells where the last attribute ends in the start tag
+func attrEnd(tag []byte) int {
+	tag = bytes.TrimSuffix(bytes.TrimSuffix(tag, []byte(">")), []byte("/"))
+	return len(bytes.TrimRight(tag, " \t\r\n"))
+}
+
+// fixApply makes the fixed text out of the patches, in their order
+func fixApply(text []byte, patches []fixPatch) []byte {
+	var buf bytes.Buffer
+	last := 0
+	for _, p := range patches {
+		buf.Write(text[last:p.start])
+		buf.WriteString(p.value)
+		last = p.end
+	}
+	buf.Write(text[last:])
+	return buf.Bytes()
+}
+
+// fixEncoding encodes the fixed text the way the source is, UTF-8 with
+// or without BOM, or UTF-16, little or big endian, with or without BOM
+func fixEncoding(source, fixed []byte) []byte {
+	var order binary.ByteOrder
+	bom := true
+	switch {
+	case bytes.HasPrefix(source, []byte{0xEF, 0xBB, 0xBF}):
+		return append([]byte{0xEF, 0xBB, 0xBF}, fixed...)
+	case bytes.HasPrefix(source, []byte{0xFF, 0xFE}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(source, []byte{0xFE, 0xFF}):
+		order = binary.BigEndian
+	case bytes.HasPrefix(source, []byte{'<', 0}):
+		order, bom = binary.LittleEndian, false
+	case bytes.HasPrefix(source, []byte{0, '<'}):
+		order, bom = binary.BigEndian, false
+	default:
+		return fixed
+	}
+	u16s := utf16.Encode([]rune(string(fixed)))
+	if bom {
+		u16s = append([]uint16{0xFEFF}, u16s...)
+	}
+	b := make([]byte, len(u16s)*2)
+	for i, u := range u16s {
+		order.PutUint16(b[i*2:], u)
+	}
+	return b
+}
+
+// FixDiff shows the changes that Fix makes to the source as a unified
+// diff. The fixes only change attribute values, so the lines of the two
+// pair up
+func FixDiff(w io.Writer, script string, source, fixed []byte) {
+	a := bytes.SplitAfter(ToUtf8(source), []byte("\n"))
+	b := bytes.SplitAfter(ToUtf8(fixed), []byte("\n"))
+	n := len(a)
+	if len(a[n-1]) == 0 {
+		// the empty piece after the last newline
+		n--
+	}
+	changed := func(i int) bool { return !bytes.Equal(a[i], b[i]) }
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", script, script)
+	for i := 0; i < n; i++ {
+		if !changed(i) {
+			continue
+		}
+		// a hunk takes in the changes that are close enough to share
+		// their context lines
+		start, end := i-diffContext, i+1
+		if start < 0 {
+			start = 0
+		}
+		for j := end; j < n && j < end+2*diffContext; j++ {
+			if changed(j) {
+				end = j + 1
+			}
+		}
+		stop := end + diffContext
+		if stop > n {
+			stop = n
+		}
+		fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n",
+			start+1, stop-start, start+1, stop-start)
+		for k := start; k < stop; {
+			if !changed(k) {
+				diffLine(w, " ", a[k])
+				k++
+				continue
+			}
+			run := k
+			for ; run < stop && changed(run); run++ {
+				diffLine(w, "-", a[run])
+			}
+			for ; k < run; k++ {
+				diffLine(w, "+", b[k])
+			}
+		}
+		i = stop - 1
+	}
+}
+
+func diffLine(w io.Writer, prefix string, line []byte) {
+	fmt.Fprintf(w, "%s%s", prefix, line)
+	if !bytes.HasSuffix(line, []byte("\n")) {
+		fmt.Fprintf(w, "\n\\ No newline at end of file\n")
+	}
+}
@@ -0,0 +1,117 @@
+package webtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// fixText fixes the web test text to ThinkTime 0 and Timeout 270
+func fixText(t *testing.T, text string) string {
+	patches, err := fixRequests(ioutil.Discard, []byte(text),
+		FixOptions{ThinkTime: 0, Timeout: 270})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(fixApply([]byte(text), patches))
+}
+
+func TestFix(t *testing.T) {
+	sample := readSample(t)
+	// only the first request and its dependent one are not canonical
+	want := strings.Replace(string(sample),
+		`ThinkTime="3" Timeout="60"`, `ThinkTime="0" Timeout="270"`, 1)
+	want = strings.Replace(want,
+		`ThinkTime="0" Timeout="60"`, `ThinkTime="0" Timeout="270"`, 1)
+
+	tests := []struct {
+		name, text, want string
+	}{
+		{"sample", string(sample), want},
+		{"single quotes and spaces",
+			`<WebTest><Items><Request Url="a" ThinkTime = '5'  Timeout='30'/></Items></WebTest>`,
+			`<WebTest><Items><Request Url="a" ThinkTime = '0'  Timeout='270'/></Items></WebTest>`},
+		{"start tag on lines",
+			"<WebTest>\n<Items>\n<Request Url=\"a\"\n  ThinkTime=\"1\"\n  Timeout=\"300\">\n</Request>\n</Items>\n</WebTest>\n",
+			"<WebTest>\n<Items>\n<Request Url=\"a\"\n  ThinkTime=\"0\"\n  Timeout=\"300\">\n</Request>\n</Items>\n</WebTest>\n"},
+		{"Timeout not lowered",
+			`<WebTest><Items><Request ThinkTime="0" Timeout="600" /></Items></WebTest>`,
+			`<WebTest><Items><Request ThinkTime="0" Timeout="600" /></Items></WebTest>`},
+		{"missing attributes added",
+			`<WebTest><Items><Request Url="a" /><Request Url="b"></Request></Items></WebTest>`,
+			`<WebTest><Items><Request Url="a" Timeout="270" /><Request Url="b" Timeout="270"></Request></Items></WebTest>`},
+		{"missing ThinkTime is 0, and so is 00",
+			`<WebTest><Items><Request Url="a" Timeout="300" /><Request ThinkTime="00" Timeout="300" /></Items></WebTest>`,
+			`<WebTest><Items><Request Url="a" Timeout="300" /><Request ThinkTime="00" Timeout="300" /></Items></WebTest>`},
+		{"other attributes untouched",
+			`<WebTest><Items><Request Url="x?ThinkTime=5" MyTimeout="1" ThinkTime="5" Timeout="1" /></Items></WebTest>`,
+			`<WebTest><Items><Request Url="x?ThinkTime=5" MyTimeout="1" ThinkTime="0" Timeout="270" /></Items></WebTest>`},
+	}
+	for _, tt := range tests {
+		if got := fixText(t, tt.text); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFixDiff(t *testing.T) {
+	lines := func(from, to int, changed ...int) string {
+		var buf bytes.Buffer
+		for i := from; i <= to; i++ {
+			l := "line " + string(rune('a'+i-1))
+			for _, c := range changed {
+				if c == i {
+					l += " fixed"
+				}
+			}
+			buf.WriteString(l + "\n")
+		}
+		return buf.String()
+	}
+	tests := []struct {
+		name, source, fixed string
+		want                string
+	}{
+		{"one change", lines(1, 10), lines(1, 10, 5),
+			"@@ -2,7 +2,7 @@\n line b\n line c\n line d\n-line e\n+line e fixed\n line f\n line g\n line h\n"},
+		{"changes sharing the context", lines(1, 10), lines(1, 10, 1, 2, 8),
+			"@@ -1,10 +1,10 @@\n-line a\n-line b\n+line a fixed\n+line b fixed\n line c\n line d\n line e\n line f\n line g\n-line h\n+line h fixed\n line i\n line j\n"},
+		{"separate hunks", lines(1, 20), lines(1, 20, 2, 18),
+			"@@ -1,5 +1,5 @@\n line a\n-line b\n+line b fixed\n line c\n line d\n line e\n" +
+				"@@ -15,6 +15,6 @@\n line o\n line p\n line q\n-line r\n+line r fixed\n line s\n line t\n"},
+		{"no newline at end", "a\nb", "a\nc",
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		FixDiff(&buf, "a.webtest", []byte(tt.source), []byte(tt.fixed))
+		if want := "--- a.webtest\n+++ a.webtest\n" + tt.want; buf.String() != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, buf.String(), want)
+		}
+	}
+}
+
+func TestFixEncoding(t *testing.T) {
+	text := []byte("<?xml version=\"1.0\" encoding=\"utf-16\"?>\r\n<WebTest />\r\n")
+	u16 := func(order binary.ByteOrder, bom bool) []byte {
+		var buf bytes.Buffer
+		if bom {
+			binary.Write(&buf, order, uint16(0xFEFF))
+		}
+		for _, u := range utf16.Encode([]rune(string(text))) {
+			binary.Write(&buf, order, u)
+		}
+		return buf.Bytes()
+	}
+	for _, source := range [][]byte{text,
+		append([]byte{0xEF, 0xBB, 0xBF}, text...),
+		u16(binary.LittleEndian, true), u16(binary.BigEndian, true),
+		u16(binary.LittleEndian, false), u16(binary.BigEndian, false)} {
+		if got := fixEncoding(source, text); !bytes.Equal(got, source) {
+			t.Errorf("got % x\nwant % x", got, source)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-fmt
+// Purpose: wts (web test script) canonical formatting
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// FormatOptions tells how to format the web test scripts
+type FormatOptions struct {
+	// Eol is the line ending, CRLF the way Visual Studio writes by default
+	Eol string
+	// Guids makes the request Guids and the condition and loop ids
+	// deterministic
+	Guids bool
+}
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// Format writes the WebTest out canonically, the Visual Studio layout with
+// the attributes in the modeled order, followed by the rest sorted by
+// name. The WebTest is changed in doing so
+func (wt *WebTest) Format(w io.Writer, opt FormatOptions) error {
+	sortAttrs(reflect.ValueOf(wt))
+	if opt.Guids {
+		wt.stableGuids()
+	}
+	if len(opt.Eol) == 0 || opt.Eol == "\r\n" {
+		return wt.Encode(w)
+	}
+	var buf bytes.Buffer
+	if err := wt.Encode(&buf); err != nil {
+		return err
+	}
+	_, err := w.Write(bytes.Replace(buf.Bytes(), []byte("\r\n"),
+		[]byte(opt.Eol), -1))
+	return err
+}
+
+// sortAttrs sorts the attributes not modeled, the Attrs, by name, all
+// through v
+func sortAttrs(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			sortAttrs(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			sortAttrs(v.Field(i))
+		}
+	case reflect.Slice:
+		if attrs, ok := v.Interface().([]xml.Attr); ok {
+			sort.SliceStable(attrs, func(i, j int) bool {
+				return attrs[i].Name.Local < attrs[j].Name.Local
+			})
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			sortAttrs(v.Index(i))
+		}
+	}
+}
+
+// stableGuids replaces the request Guids and the condition and loop ids
+// with the ones derived from the web test name and what the requests,
+// conditions and loops are, so that they stay the same when recorded or
+// saved again
+func (wt *WebTest) stableGuids() {
+	seen := map[string]int{}
+	guid := func(what string) string {
+		seen[what]++
+		return nameGuid(wt.Name + "\n" + what + "\n" + strconv.Itoa(seen[what]))
+	}
+	var request func(r *Request)
+	request = func(r *Request) {
+		r.Guid = guid("Request " + r.Method + " " + r.Url)
+		for _, d := range r.DependentRequests {
+			request(d)
+		}
+	}
+	var walk func(items Items)
+	walk = func(items Items) {
+		for _, item := range items {
+			switch t := item.(type) {
+			case *Request:
+				request(t)
+			case *TransactionTimer:
+				walk(t.Items)
+			case *Loop:
+				t.UniqueStringId = guid("Loop " + InlineXml(t.ConditionalRule))
+				walk(t.Items)
+			case *Condition:
+				t.UniqueStringId = guid("Condition " + InlineXml(t.ConditionalRule))
+				if t.Then != nil {
+					walk(t.Then.Items)
+				}
+				if t.Else != nil {
+					walk(t.Else.Items)
+				}
+			}
+		}
+	}
+	walk(wt.Items)
+}
+
+// nameGuid makes the name based GUID of the name
+func nameGuid(name string) string {
+	u := sha1.Sum([]byte(name))
+	u[6] = u[6]&0x0f | 0x50 // version 5
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
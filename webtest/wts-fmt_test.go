@@ -0,0 +1,117 @@
+package webtest
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// formatString formats the web test source with the options
+func formatString(t *testing.T, source string, opt FormatOptions) string {
+	wt, err := Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := wt.Format(&buf, opt); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name, source string
+		opt          FormatOptions
+		want         string
+	}{
+		{"modeled attributes in order, the rest sorted",
+			`<WebTest Zeta="z" Name="T" Alpha="a"><Items><Comment B="2" CommentText="c" A="1" /></Items></WebTest>`,
+			FormatOptions{},
+			`<WebTest Name="T" Owner="" Priority="" Enabled="" CssProjectStructure="" CssIteration="" ` +
+				`Timeout="" WorkItemIds="" Description="" CredentialUserName="" CredentialPassword="" ` +
+				`PreAuthenticate="" Proxy="" StopOnError="" ResultsLocale="" Alpha="a" Zeta="z">` + "\r\n" +
+				`  <Items>` + "\r\n" + `    <Comment CommentText="c" A="1" B="2" />` + "\r\n"},
+		{"LF line endings",
+			`<WebTest Name="T"><Items><Comment CommentText="c" /></Items></WebTest>`,
+			FormatOptions{Eol: "\n"},
+			"<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<WebTest Name=\"T\" "},
+	}
+	for _, tt := range tests {
+		got := formatString(t, tt.source, tt.opt)
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+		if tt.opt.Eol == "\n" && strings.Contains(got, "\r") {
+			t.Errorf("%s: CR in\n%s", tt.name, got)
+		}
+		if again := formatString(t, got, tt.opt); again != got {
+			t.Errorf("%s: not stable, got\n%s\nthen\n%s", tt.name, got, again)
+		}
+	}
+
+	sample := string(readSample(t))
+	if got := formatString(t, sample, FormatOptions{}); got != sample {
+		t.Errorf("the Visual Studio layout changed:\n%s", got)
+	}
+}
+
+func TestFormatGuids(t *testing.T) {
+	req := func(guid, url string) string {
+		return `<Request Method="GET" Guid="` + guid + `" Url="` + url + `" />`
+	}
+	items := req("g1", "/a") + `<TransactionTimer Name="T"><Items>` + req("g2", "/a") +
+		`</Items></TransactionTimer>` +
+		`<Loop UniqueStringId="l1"><ConditionalRule DisplayName="For" /><Items>` +
+		`<Request Method="GET" Guid="g3" Url="/b"><DependentRequests>` + req("g4", "/c") +
+		`</DependentRequests></Request></Items></Loop>` +
+		`<Condition UniqueStringId="c1"><ConditionalRule DisplayName="If" /></Condition>`
+	source := func(name, items string) string {
+		return `<WebTest Name="` + name + `"><Items>` + items + `</Items></WebTest>`
+	}
+	idRe := regexp.MustCompile(`(Guid|UniqueStringId)="([^"]*)"`)
+	ids := func(s string) []string {
+		var l []string
+		for _, m := range idRe.FindAllStringSubmatch(s, -1) {
+			l = append(l, m[2])
+		}
+		return l
+	}
+	opt := FormatOptions{Guids: true}
+
+	got := ids(formatString(t, source("W", items), opt))
+	if len(got) != 6 {
+		t.Fatalf("ids %q", got)
+	}
+	seen := map[string]bool{}
+	uuidRe := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, id := range got {
+		if !uuidRe.MatchString(id) || seen[id] {
+			t.Errorf("id %s not a distinct version 5 GUID", id)
+		}
+		seen[id] = true
+	}
+
+	tests := []struct {
+		name, source string
+		same         bool
+	}{
+		{"formatted again", source("W", items), true},
+		{"recorded again, other ids", strings.NewReplacer(`"g1"`, `"x1"`, `"g3"`, `"x3"`,
+			`"l1"`, `"y"`).Replace(source("W", items)), true},
+		{"other web test", source("V", items), false},
+	}
+	for _, tt := range tests {
+		again := ids(formatString(t, tt.source, opt))
+		if same := strings.Join(again, " ") == strings.Join(got, " "); same != tt.same {
+			t.Errorf("%s: ids %q, first %q", tt.name, again, got)
+		}
+	}
+
+	// the ids of the requests before the one added stay the same
+	added := ids(formatString(t, source("W", req("g0", "/new")+items), opt))
+	if added[1] != got[0] || added[2] != got[1] {
+		t.Errorf("ids %q shifted, first %q", added, got)
+	}
+}
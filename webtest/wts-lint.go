@@ -0,0 +1,361 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-lint
+// Purpose: wts (web test script) lint rules for the check verb
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+/*
+
+The lint rules can be configured with a YAML file like this:
+
+  rules:
+    hardcoded-host:
+      severity: error
+    missing-reporting-name:
+      enabled: true
+    record-result-false:
+      params:
+        pattern: '/api/|\.svc'
+
+*/
+type LintConfig struct {
+	Rules map[string]struct {
+		Enabled  *bool
+		Severity string
+		Params   map[string]string
+	}
+}
+
+// CheckOptions are the settings of a Checker
+type CheckOptions struct {
+	ThinkTime int    // the canonical ThinkTime
+	Timeout   int    // the canonical, i.e., minimum, Timeout
+	Checks    string // the check-regexp pattern
+	Rules     string // the YAML lint rules configuration file, if any
+	KeepGoing bool   // report all the problems, not just the first
+}
+
+// Checker lints web test scripts, with its own copy of the lint rules
+type Checker struct {
+	opt   CheckOptions
+	rules map[string]*lintRule
+}
+
+// CheckResult is the outcome of checking one web test script
+type CheckResult struct {
+	Script            string
+	Findings          []Finding
+	Requests          int
+	DependentRequests int
+}
+
+// Finding is a lint rule violation found by the Checker
+type Finding struct {
+	Rule        string `json:"rule"`
+	Severity    string `json:"severity"`
+	Message     string `json:"message"`
+	Transaction string `json:"transaction"`
+	Comment     string `json:"comment"`
+	Request     int    `json:"request"`             // 1-based, 0 for script-wide ones
+	Dependent   int    `json:"dependent,omitempty"` // 1-based within Request
+	Url         string `json:"url,omitempty"`
+	Line        int    `json:"line,omitempty"` // of the request in the script
+}
+
+// lintRule is a named lint rule. The check func tells what is wrong with
+// the request, given the request text as dumped, or "" if nothing is
+type lintRule struct {
+	desc     string
+	severity string
+	enabled  bool
+	params   map[string]string
+	re       *regexp.Regexp // the compiled "pattern" param, if any
+	check    func(l *lintRule, r Request, text string) string
+}
+
+// lintRules are all the known lint rules, as they are by default. The
+// script-wide ones have no check func, but are checked by
+// lintState.transaction and lintState.webTest
+var lintRules = map[string]*lintRule{
+	"think-time": {
+		desc: "ThinkTime is not the canonical value", severity: "warning",
+		enabled: true, params: map[string]string{"value": "0"},
+		check: func(l *lintRule, r Request, text string) string {
+			// as numbers, a missing ThinkTime is 0 as well
+			tt, _ := strconv.Atoi(r.ThinkTime)
+			value, _ := strconv.Atoi(l.params["value"])
+			if tt != value {
+				return fmt.Sprintf("ThinkTime %s is not %d", r.ThinkTime, value)
+			}
+			return ""
+		}},
+	"timeout": {
+		desc: "Timeout is less than the canonical value", severity: "warning",
+		enabled: true, params: map[string]string{"min": "270"},
+		check: func(l *lintRule, r Request, text string) string {
+			to, _ := strconv.Atoi(r.Timeout)
+			min, _ := strconv.Atoi(l.params["min"])
+			if to < min {
+				return fmt.Sprintf("Timeout %s is less than %d", r.Timeout, min)
+			}
+			return ""
+		}},
+	"check-regexp": {
+		desc: "The request matches the check regexp", severity: "warning",
+		enabled: true, params: map[string]string{"pattern": ""},
+		check: func(l *lintRule, r Request, text string) string {
+			if m := l.re.FindString(text); len(m) != 0 {
+				return fmt.Sprintf("'%s' found", m)
+			}
+			return ""
+		}},
+	"hardcoded-host": {
+		desc:     "The Url has a hard-coded host instead of a context parameter",
+		severity: "error", enabled: true,
+		params: map[string]string{"pattern": `^https?://`},
+		check: func(l *lintRule, r Request, text string) string {
+			if l.re.MatchString(r.Url) {
+				return "hard-coded host in " + r.Url
+			}
+			return ""
+		}},
+	"missing-reporting-name": {
+		desc: "The request has no ReportingName", severity: "info",
+		params: map[string]string{"pattern": "."},
+		check: func(l *lintRule, r Request, text string) string {
+			if len(r.ReportingName) == 0 && l.re.MatchString(r.Url) {
+				return "no ReportingName"
+			}
+			return ""
+		}},
+	"record-result-false": {
+		desc: "RecordResult is False on a key request", severity: "warning",
+		enabled: true, params: map[string]string{"pattern": "."},
+		check: func(l *lintRule, r Request, text string) string {
+			if r.RecordResult == "False" && l.re.MatchString(r.Url) {
+				return "RecordResult is False"
+			}
+			return ""
+		}},
+	"missing-validation": {
+		desc: "The request has no validation rules", severity: "info",
+		params: map[string]string{"pattern": "."},
+		check: func(l *lintRule, r Request, text string) string {
+			if len(r.ValidationRules) == 0 && l.re.MatchString(r.Url) {
+				return "no validation rules"
+			}
+			return ""
+		}},
+	"parse-dependent-api": {
+		desc: "ParseDependentRequests is True on an API call", severity: "warning",
+		enabled: true,
+		params:  map[string]string{"pattern": `(?i)/api/|\.svc|\.asmx|\.ashx`},
+		check: func(l *lintRule, r Request, text string) string {
+			if r.ParseDependentRequests == "True" && l.re.MatchString(r.Url) {
+				return "ParseDependentRequests is True on an API call"
+			}
+			return ""
+		}},
+	"stop-on-error": {
+		desc:     "StopOnError is False, the web test goes on after a failed request",
+		severity: "warning", enabled: true},
+	"plain-text-credentials": {
+		desc:     "The CredentialPassword is in plain text, instead of a context parameter",
+		severity: "error", enabled: true},
+	"duplicate-transaction": {
+		desc: "The transaction name is used more than once", severity: "error",
+		enabled: true},
+}
+
+// lintState is the lint progress and findings of one web test script
+type lintState struct {
+	rules              map[string]*lintRule
+	findings           []Finding
+	reqIndex           int
+	depIndex, depCount int // the dependent requests
+	transactions       map[string]int
+}
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// NewChecker applies the options, then the YAML configuration of
+// opt.Rules if given, to a copy of the lint rules
+func NewChecker(opt CheckOptions) (*Checker, error) {
+	rules := make(map[string]*lintRule, len(lintRules))
+	for id, l := range lintRules {
+		c := *l
+		c.params = make(map[string]string, len(l.params))
+		for k, v := range l.params {
+			c.params[k] = v
+		}
+		rules[id] = &c
+	}
+	rules["think-time"].params["value"] = strconv.Itoa(opt.ThinkTime)
+	rules["timeout"].params["min"] = strconv.Itoa(opt.Timeout)
+	rules["check-regexp"].params["pattern"] = opt.Checks
+
+	if len(opt.Rules) != 0 {
+		source, err := ioutil.ReadFile(opt.Rules)
+		if err != nil {
+			return nil, err
+		}
+		var c LintConfig
+		if err := yaml.Unmarshal(source, &c); err != nil {
+			return nil, fmt.Errorf("lint rules %s: %v", opt.Rules, err)
+		}
+		for id, rc := range c.Rules {
+			l, ok := rules[id]
+			if !ok {
+				return nil, fmt.Errorf("lint rules %s: unknown rule '%s'",
+					opt.Rules, id)
+			}
+			if rc.Enabled != nil {
+				l.enabled = *rc.Enabled
+			}
+			if len(rc.Severity) != 0 {
+				if !IsSeverity(rc.Severity) {
+					return nil, fmt.Errorf(
+						"lint rules %s: rule '%s': unknown severity '%s'",
+						opt.Rules, id, rc.Severity)
+				}
+				l.severity = rc.Severity
+			}
+			for k, v := range rc.Params {
+				if l.params == nil {
+					l.params = map[string]string{}
+				}
+				l.params[k] = v
+			}
+		}
+	}
+
+	for id, l := range rules {
+		if p, ok := l.params["pattern"]; ok && l.enabled {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("lint rule %s: %v", id, err)
+			}
+			l.re = re
+		}
+	}
+	return &Checker{opt, rules}, nil
+}
+
+// Check lints the web test script read from r, showing the findings with
+// their requests to out, in the dump form. The findings so far are
+// returned with the error, if any, in --keep-going mode as well
+func (c *Checker) Check(script string, r io.Reader,
+	out io.Writer) (*CheckResult, error) {
+	// the request text is checked in its (plain) dump form
+	dp, err := NewDumper(script, DumpOptions{KeepGoing: c.opt.KeepGoing})
+	if err != nil {
+		return nil, err
+	}
+	dp.checkOnly, dp.out = true, out
+	dp.lint = &lintState{rules: c.rules, transactions: map[string]int{}}
+	decoder, err := dp.decoder(r)
+	if err != nil {
+		return nil, err
+	}
+	err = dp.treatWtsXml(ioutil.Discard, decoder)
+	l := dp.lint
+	return &CheckResult{script, l.findings, l.reqIndex, l.depCount}, err
+}
+
+// request runs all the enabled request rules on the request, at the line
+// of the script. The dependent requests are numbered within their
+// top-level one
+func (ls *lintState) request(r Request, text string, cur current,
+	dependent bool, line int) []Finding {
+	if dependent {
+		ls.depIndex++
+		ls.depCount++
+	} else {
+		ls.reqIndex++
+		ls.depIndex = 0
+	}
+	var found []Finding
+	for _, id := range lintRuleIds() {
+		l := ls.rules[id]
+		if !l.enabled || l.check == nil {
+			continue
+		}
+		if msg := l.check(l, r, text); len(msg) != 0 {
+			found = append(found, Finding{Rule: id, Severity: l.severity,
+				Message: msg, Transaction: cur.transaction, Comment: cur.comment,
+				Request: ls.reqIndex, Dependent: ls.depIndex, Url: r.Url,
+				Line: line})
+		}
+	}
+	ls.findings = append(ls.findings, found...)
+	return found
+}
+
+// transaction checks the transaction names are unique
+func (ls *lintState) transaction(name string) []Finding {
+	ls.transactions[name]++
+	l := ls.rules["duplicate-transaction"]
+	if !l.enabled || ls.transactions[name] != 2 {
+		return nil
+	}
+	found := []Finding{{Rule: "duplicate-transaction", Severity: l.severity,
+		Message:     fmt.Sprintf("transaction '%s' is used more than once", name),
+		Transaction: name}}
+	ls.findings = append(ls.findings, found...)
+	return found
+}
+
+// webTest checks the WebTest settings, with the CredentialPassword
+// masked if it is in plain text
+func (ls *lintState) webTest(s Settings) []Finding {
+	var found []Finding
+	add := func(id, msg string) {
+		if l := ls.rules[id]; l.enabled {
+			found = append(found,
+				Finding{Rule: id, Severity: l.severity, Message: msg})
+		}
+	}
+	if s.StopOnError == "False" {
+		add("stop-on-error", "StopOnError is False")
+	}
+	if s.CredentialPassword == SecretMask {
+		add("plain-text-credentials", fmt.Sprintf(
+			"plain-text CredentialPassword for '%s'", s.CredentialUserName))
+	}
+	ls.findings = append(ls.findings, found...)
+	return found
+}
+
+func lintRuleIds() []string {
+	ids := make([]string, 0, len(lintRules))
+	for id := range lintRules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func printFindings(w io.Writer, found []Finding) {
+	for _, f := range found {
+		fmt.Fprintf(w, "L: (%s, %s) %s\r\n", f.Rule, f.Severity, f.Message)
+	}
+}
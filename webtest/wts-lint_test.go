@@ -0,0 +1,171 @@
+package webtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// checkWith checks the web test source, the sample one if empty, with the
+// YAML lint rules configuration if given
+func checkWith(t *testing.T, source, config string) (*CheckResult, error) {
+	opt := CheckOptions{ThinkTime: 0, Timeout: 270}
+	if len(config) != 0 {
+		dir, err := ioutil.TempDir("", "wts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		opt.Rules = filepath.Join(dir, "lint.yaml")
+		if err := ioutil.WriteFile(opt.Rules, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := NewChecker(opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(source) == 0 {
+		source = string(readSample(t))
+	}
+	return c.Check("Sample.webtest", strings.NewReader(source), ioutil.Discard)
+}
+
+// findingList lists the findings as rule(severity)@request.dependent
+func findingList(found []Finding) string {
+	var list []string
+	for _, f := range found {
+		list = append(list,
+			fmt.Sprintf("%s(%s)@%d.%d", f.Rule, f.Severity, f.Request, f.Dependent))
+	}
+	return strings.Join(list, " ")
+}
+
+func TestCheckRules(t *testing.T) {
+	sampleDefault := "stop-on-error(warning)@0.0 hardcoded-host(error)@1.0 " +
+		"think-time(warning)@1.0 timeout(warning)@1.0 hardcoded-host(error)@1.1 " +
+		"timeout(warning)@1.1 hardcoded-host(error)@2.0 record-result-false(warning)@3.0"
+	transactions := `<WebTest Name="T" StopOnError="True" CredentialUserName="bob" CredentialPassword="secret">
+  <Items>
+    <TransactionTimer Name="A"><Items /></TransactionTimer>
+    <TransactionTimer Name="B"><Items /></TransactionTimer>
+    <TransactionTimer Name="A"><Items /></TransactionTimer>
+    <TransactionTimer Name="A"><Items /></TransactionTimer>
+  </Items>
+</WebTest>`
+	tests := []struct {
+		name, source, config string
+		want                 string
+	}{
+		{"default", "", "", sampleDefault},
+		{"disabled", "", "rules:\n  hardcoded-host:\n    enabled: false\n" +
+			"  stop-on-error:\n    enabled: false\n",
+			"think-time(warning)@1.0 timeout(warning)@1.0 timeout(warning)@1.1 " +
+				"record-result-false(warning)@3.0"},
+		{"severity", "", "rules:\n  timeout:\n    severity: error\n" +
+			"  hardcoded-host:\n    enabled: false\n  stop-on-error:\n    enabled: false\n",
+			"think-time(warning)@1.0 timeout(error)@1.0 timeout(error)@1.1 " +
+				"record-result-false(warning)@3.0"},
+		{"params", "", "rules:\n  hardcoded-host:\n    params:\n      pattern: '\\.svc$'\n" +
+			"  missing-reporting-name:\n    enabled: true\n    params:\n      pattern: 'login'\n" +
+			"  timeout:\n    params:\n      min: 30\n  stop-on-error:\n    enabled: false\n",
+			"think-time(warning)@1.0 hardcoded-host(error)@2.0 " +
+				"missing-reporting-name(info)@3.0 record-result-false(warning)@3.0"},
+		{"script-wide", transactions, "",
+			"plain-text-credentials(error)@0.0 duplicate-transaction(error)@0.0"},
+	}
+	for _, tt := range tests {
+		res, err := checkWith(t, tt.source, tt.config)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := findingList(res.Findings); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCounts(t *testing.T) {
+	res, err := checkWith(t, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Requests != 3 || res.DependentRequests != 1 {
+		t.Errorf("%d requests, %d dependent ones", res.Requests, res.DependentRequests)
+	}
+	f := res.Findings[1]
+	if f.Transaction != "Login" || f.Comment != "[#1] start" ||
+		f.Url != "http://web01.example.com/force/u/CB42/Account/LogOn" {
+		t.Errorf("finding not located: %+v", f)
+	}
+}
+
+func TestCheckConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{"rules:\n  no-such-rule:\n    enabled: true\n", "unknown rule 'no-such-rule'"},
+		{"rules:\n  timeout:\n    severity: eror\n", "rule 'timeout': unknown severity 'eror'"},
+		{"rules:\n  hardcoded-host:\n    params:\n      pattern: '('\n",
+			"lint rule hardcoded-host: error parsing regexp"},
+		{"rules: [", "lint rules"},
+	}
+	for _, tt := range tests {
+		_, err := checkWith(t, "", tt.config)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error %v, want %q", tt.config, err, tt.err)
+		}
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	c, err := NewChecker(CheckOptions{Timeout: 270})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := c.Check("Sample.webtest", bytes.NewReader(readSample(t)), &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "L: (think-time, warning) ThinkTime 3 is not 0\r\n"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("no %q in\n%s", want, buf.String())
+	}
+}
+
+func TestCheckThinkTime(t *testing.T) {
+	tests := []struct {
+		thinkTime, value string
+		found            bool
+	}{
+		{`ThinkTime="0"`, "", false},
+		{"", "", false},
+		{`ThinkTime=""`, "", false},
+		{`ThinkTime="00"`, "", false},
+		{`ThinkTime="3"`, "", true},
+		{`ThinkTime="03"`, "3", false},
+		{"", "3", true},
+	}
+	for _, tt := range tests {
+		config := ""
+		if len(tt.value) != 0 {
+			config = "rules:\n  think-time:\n    params:\n      value: \"" + tt.value + "\"\n"
+		}
+		source := string(webTestOf(`<Request Method="GET" Url="{{web}}a" Timeout="300" ` +
+			tt.thinkTime + ` />`))
+		res, err := checkWith(t, source, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := strings.Contains(findingList(res.Findings), "think-time")
+		if found != tt.found {
+			t.Errorf("%q against %q: found %v", tt.thinkTime, tt.value, found)
+		}
+	}
+}
@@ -0,0 +1,542 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-merge
+// Purpose: wts (web test script) three-way merge, request by request
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// the conflict markers, as git writes them
+const (
+	mergeOurs   = "<<<<<<< ours"
+	mergeSep    = "======="
+	mergeTheirs = ">>>>>>> theirs"
+)
+
+// mergeToken is the attribute value of the placeholders standing for the
+// conflicts in the merged model, followed by the conflict index
+const mergeToken = "wts-merge-conflict-"
+
+// mergeEntry is an element of a list being merged, the Items, the
+// ContextParameters etc, with the key that tells which ones are the same
+// element in the three versions, and the text that tells if it is changed
+type mergeEntry struct {
+	key   string
+	text  string
+	name  string // the element name
+	value interface{}
+}
+
+// mergeOut is an element of the merged list, or a conflict between ours
+// and theirs when there is no value
+type mergeOut struct {
+	value        interface{}
+	ours, theirs []mergeEntry
+}
+
+// merger collects the conflicts, each represented in the merged model by a
+// placeholder until written out
+type merger struct {
+	conflicts []mergeOut
+}
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// Merge merges the changes made to base in ours and in theirs, request by
+// request, and writes the merged web test to w. The requests and other
+// elements changed differently on the two sides are written as they are on
+// both, in between the conflict markers. It returns how many conflicts
+// there are
+func Merge(w io.Writer, base, ours, theirs *WebTest) (int, error) {
+	m := &merger{}
+	wt := *ours
+	wt.Items = m.items(base.Items, ours.Items, theirs.Items)
+	wt.Unknown = nil
+	for _, v := range m.list("", values(base.Unknown), values(ours.Unknown),
+		values(theirs.Unknown), nodeKey) {
+		wt.Unknown = append(wt.Unknown, *v.(*Node))
+	}
+	wt.DataSources = nil
+	for _, v := range m.list("DataSource", values(base.DataSources),
+		values(ours.DataSources), values(theirs.DataSources),
+		func(v interface{}) string { return v.(*DataSource).Name }) {
+		wt.DataSources = append(wt.DataSources, *v.(*DataSource))
+	}
+	wt.ContextParameters = nil
+	for _, v := range m.list("ContextParameter", values(base.ContextParameters),
+		values(ours.ContextParameters), values(theirs.ContextParameters),
+		func(v interface{}) string { return v.(*ContextParameter).Name }) {
+		wt.ContextParameters = append(wt.ContextParameters, *v.(*ContextParameter))
+	}
+	wt.ValidationRules = nil
+	for _, v := range m.list("ValidationRule", values(base.ValidationRules),
+		values(ours.ValidationRules), values(theirs.ValidationRules),
+		func(v interface{}) string { return v.(*ValidationRule).Classname }) {
+		wt.ValidationRules = append(wt.ValidationRules, *v.(*ValidationRule))
+	}
+	wt.WebTestPlugins = nil
+	for _, v := range m.list("WebTestPlugin", values(base.WebTestPlugins),
+		values(ours.WebTestPlugins), values(theirs.WebTestPlugins),
+		func(v interface{}) string { return v.(*WebTestPlugin).Classname }) {
+		wt.WebTestPlugins = append(wt.WebTestPlugins, *v.(*WebTestPlugin))
+	}
+
+	nodes, err := encodeXmlNodes(xml.Name{Local: "WebTest"}, &wt)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.markConflicts(nodes[0]); err != nil {
+		return 0, err
+	}
+	conflicts := len(m.conflicts)
+
+	// the WebTest settings are merged one attribute at a time
+	var attrs [3][]xml.Attr
+	for i, v := range []*WebTest{base, ours, theirs} {
+		if attrs[i], err = settingAttrs(*v); err != nil {
+			return 0, err
+		}
+	}
+	root := nodes[0]
+	root.attr, root.theirs = mergeAttrs(attrs[0], attrs[1], attrs[2])
+	if root.theirs != nil {
+		conflicts++
+	}
+	return conflicts, writeXmlNodes(w, nodes)
+}
+
+// values turns the slice into the pointers to its elements
+func values(slice interface{}) []interface{} {
+	s := reflect.ValueOf(slice)
+	vs := make([]interface{}, s.Len())
+	for i := range vs {
+		vs[i] = s.Index(i).Addr().Interface()
+	}
+	return vs
+}
+
+// list merges the three versions of the list of named elements, keyed by
+// key, and returns the merged one, with the conflicts in placeholders
+func (m *merger) list(name string, base, ours, theirs []interface{},
+	key func(v interface{}) string) []interface{} {
+	entries := func(vs []interface{}) []mergeEntry {
+		l := make([]mergeEntry, len(vs))
+		for i, v := range vs {
+			l[i] = mergeEntry{key: key(v), text: InlineXml(v), name: name, value: v}
+		}
+		return numberKeys(l)
+	}
+	var merged []interface{}
+	for _, out := range m.merge(entries(base), entries(ours), entries(theirs), nil) {
+		if out.value == nil {
+			out.value = m.placeholder(name, out)
+		}
+		merged = append(merged, out.value)
+	}
+	return merged
+}
+
+// placeholder registers the conflict and makes the element standing for it
+// in the merged list of named elements
+func (m *merger) placeholder(name string, out mergeOut) interface{} {
+	token := mergeToken + strconv.Itoa(len(m.conflicts))
+	m.conflicts = append(m.conflicts, out)
+	switch name {
+	case "DataSource":
+		return &DataSource{Name: token}
+	case "ContextParameter":
+		return &ContextParameter{Name: token}
+	case "ValidationRule":
+		return &ValidationRule{Classname: token}
+	case "WebTestPlugin":
+		return &WebTestPlugin{Plugin: Plugin{Classname: token}}
+	}
+	return &Node{XMLName: xml.Name{Local: "Conflict"},
+		Attrs: []xml.Attr{{Name: xml.Name{Local: "Id"}, Value: token}}}
+}
+
+// numberKeys tells the elements of the same key apart, by their order
+func numberKeys(l []mergeEntry) []mergeEntry {
+	seen := map[string]int{}
+	for i, e := range l {
+		if n := seen[e.key]; n > 0 {
+			l[i].key = fmt.Sprintf("%s#%d", e.key, n+1)
+		}
+		seen[e.key]++
+	}
+	return l
+}
+
+func nodeKey(v interface{}) string {
+	return v.(*Node).XMLName.Local + " " + InlineXml(v)
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Items merging
+
+// itemKey tells which items are the same one in the versions of a web test
+func itemKey(item Item) string {
+	switch t := item.(type) {
+	case *Request:
+		if len(t.Guid) != 0 {
+			return "Request " + t.Guid
+		}
+		return "Request " + t.Method + " " + t.Url
+	case *TransactionTimer:
+		return "TransactionTimer " + t.Name
+	case *Condition:
+		return "Condition " + t.UniqueStringId
+	case *Loop:
+		return "Loop " + t.UniqueStringId
+	case *Comment:
+		return "Comment " + t.CommentText
+	case *IncludedWebTest:
+		return "IncludedWebTest " + t.Name
+	}
+	return item.itemName() + " " + InlineXml(item)
+}
+
+// items merges the three versions of the items, and the items within the
+// transactions, conditions and loops changed on both sides
+func (m *merger) items(base, ours, theirs Items) Items {
+	entries := func(items Items) []mergeEntry {
+		l := make([]mergeEntry, len(items))
+		for i, item := range items {
+			l[i] = mergeEntry{key: itemKey(item), text: InlineXml(item),
+				name: item.itemName(), value: item}
+		}
+		return numberKeys(l)
+	}
+	var merged Items
+	for _, out := range m.merge(entries(base), entries(ours), entries(theirs),
+		m.container) {
+		if out.value == nil {
+			out.value = m.placeholder("", out)
+		}
+		merged = append(merged, out.value.(Item))
+	}
+	return merged
+}
+
+// container merges the transaction, condition or loop changed on both
+// sides, if the container itself, all but its items, is not changed
+// differently
+func (m *merger) container(base, ours, theirs interface{}) (interface{}, bool) {
+	switch a := ours.(type) {
+	case *TransactionTimer:
+		b, ok := theirs.(*TransactionTimer)
+		o, _ := base.(*TransactionTimer)
+		if o == nil {
+			o = &TransactionTimer{}
+		}
+		shell := func(t TransactionTimer) string {
+			t.Items = nil
+			return InlineXml(&t)
+		}
+		useTheirs, same := mergeShell(shell(*o), shell(*a), shell(*b))
+		if !ok || !same {
+			return nil, false
+		}
+		t := *a
+		if useTheirs {
+			t = *b
+		}
+		t.Items = m.items(o.Items, a.Items, b.Items)
+		return &t, true
+	case *Loop:
+		b, ok := theirs.(*Loop)
+		o, _ := base.(*Loop)
+		if o == nil {
+			o = &Loop{}
+		}
+		shell := func(l Loop) string {
+			l.Items = nil
+			return InlineXml(&l)
+		}
+		useTheirs, same := mergeShell(shell(*o), shell(*a), shell(*b))
+		if !ok || !same {
+			return nil, false
+		}
+		l := *a
+		if useTheirs {
+			l = *b
+		}
+		l.Items = m.items(o.Items, a.Items, b.Items)
+		return &l, true
+	case *Condition:
+		b, ok := theirs.(*Condition)
+		o, _ := base.(*Condition)
+		if o == nil {
+			o = &Condition{}
+		}
+		shell := func(c Condition) string {
+			c.Then, c.Else = nil, nil
+			return InlineXml(&c)
+		}
+		useTheirs, same := mergeShell(shell(*o), shell(*a), shell(*b))
+		if !ok || !same {
+			return nil, false
+		}
+		c := *a
+		if useTheirs {
+			c = *b
+		}
+		c.Then = m.branch(o.Then, a.Then, b.Then)
+		c.Else = m.branch(o.Else, a.Else, b.Else)
+		return &c, true
+	}
+	return nil, false
+}
+
+// branch merges the Then or Else of a condition
+func (m *merger) branch(base, ours, theirs *Branch) *Branch {
+	if ours == nil && theirs == nil {
+		return nil
+	}
+	var items [3]Items
+	for i, b := range []*Branch{base, ours, theirs} {
+		if b != nil {
+			items[i] = b.Items
+		}
+	}
+	return &Branch{Items: m.items(items[0], items[1], items[2])}
+}
+
+// mergeShell tells whether to take the container itself from theirs, and
+// if it is not changed differently on the two sides
+func mergeShell(base, ours, theirs string) (useTheirs, same bool) {
+	switch {
+	case ours == theirs, theirs == base:
+		return false, true
+	case ours == base:
+		return true, true
+	}
+	return false, false
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Three-way list merging
+
+// merge merges the three versions of a list. The element changed on one
+// side only is taken from there, and the one changed differently on both
+// is merged by recurse if given, or else is a conflict. The order follows
+// ours, or theirs if only theirs reordered the list, with the elements
+// added by the other side after the ones they follow there
+func (m *merger) merge(base, ours, theirs []mergeEntry,
+	recurse func(base, ours, theirs interface{}) (interface{}, bool)) []mergeOut {
+	index := func(l []mergeEntry) map[string]*mergeEntry {
+		idx := map[string]*mergeEntry{}
+		for i := range l {
+			idx[l[i].key] = &l[i]
+		}
+		return idx
+	}
+	byBase, byOurs, byTheirs := index(base), index(ours), index(theirs)
+
+	first, second, inFirst := ours, theirs, byOurs
+	if sameOrder(base, ours, byOurs) && !sameOrder(base, theirs, byTheirs) {
+		first, second, inFirst = theirs, ours, byTheirs
+	}
+	var head []string
+	after := map[string][]string{}
+	anchor, anchored := "", false
+	for _, e := range second {
+		if inFirst[e.key] != nil {
+			anchor, anchored = e.key, true
+		} else if anchored {
+			after[anchor] = append(after[anchor], e.key)
+		} else {
+			head = append(head, e.key)
+		}
+	}
+	keys := head
+	for _, e := range first {
+		keys = append(keys, e.key)
+		keys = append(keys, after[e.key]...)
+	}
+
+	var merged []mergeOut
+	for _, k := range keys {
+		o, a, b := byBase[k], byOurs[k], byTheirs[k]
+		switch {
+		case a != nil && b != nil:
+			switch {
+			case a.text == b.text, o != nil && b.text == o.text:
+				merged = append(merged, mergeOut{value: a.value})
+				continue
+			case o != nil && a.text == o.text:
+				merged = append(merged, mergeOut{value: b.value})
+				continue
+			}
+			if recurse != nil {
+				var ov interface{}
+				if o != nil {
+					ov = o.value
+				}
+				if v, ok := recurse(ov, a.value, b.value); ok {
+					merged = append(merged, mergeOut{value: v})
+					continue
+				}
+			}
+			merged = append(merged, mergeOut{ours: []mergeEntry{*a},
+				theirs: []mergeEntry{*b}})
+		case a != nil:
+			// unchanged by ours but removed by theirs is removed
+			if o == nil {
+				merged = append(merged, mergeOut{value: a.value})
+			} else if a.text != o.text {
+				merged = append(merged, mergeOut{ours: []mergeEntry{*a}})
+			}
+		case b != nil:
+			if o == nil {
+				merged = append(merged, mergeOut{value: b.value})
+			} else if b.text != o.text {
+				merged = append(merged, mergeOut{theirs: []mergeEntry{*b}})
+			}
+		}
+	}
+	return merged
+}
+
+// sameOrder tells if the elements of l kept in the base are still in the
+// base order
+func sameOrder(base, l []mergeEntry, inL map[string]*mergeEntry) bool {
+	var kept []string
+	for _, e := range base {
+		if inL[e.key] != nil {
+			kept = append(kept, e.key)
+		}
+	}
+	i := 0
+	for _, e := range l {
+		if i < len(kept) && e.key == kept[i] {
+			i++
+		}
+	}
+	return i == len(kept)
+}
+
+// mergeAttrs merges the attributes one by one. The ones changed
+// differently on the two sides take ours, and then theirs are returned as
+// well, the attributes with theirs values instead
+func mergeAttrs(base, ours, theirs []xml.Attr) (merged, conflict []xml.Attr) {
+	get := func(l []xml.Attr, name string) (string, bool) {
+		for _, a := range l {
+			if a.Name.Local == name {
+				return a.Value, true
+			}
+		}
+		return "", false
+	}
+	names := []string{}
+	for _, a := range ours {
+		names = append(names, a.Name.Local)
+	}
+	for _, a := range theirs {
+		if _, found := get(ours, a.Name.Local); !found {
+			names = append(names, a.Name.Local)
+		}
+	}
+
+	var alt []xml.Attr
+	differ := false
+	for _, name := range names {
+		vo, inO := get(base, name)
+		va, inA := get(ours, name)
+		vb, inB := get(theirs, name)
+		v, in, vAlt, inAlt := va, inA, va, inA
+		switch {
+		case va == vb && inA == inB, vb == vo && inB == inO:
+		case va == vo && inA == inO:
+			v, in, vAlt, inAlt = vb, inB, vb, inB
+		default:
+			vAlt, inAlt = vb, inB
+			differ = true
+		}
+		if in {
+			merged = append(merged, xml.Attr{Name: xml.Name{Local: name}, Value: v})
+		}
+		if inAlt {
+			alt = append(alt, xml.Attr{Name: xml.Name{Local: name}, Value: vAlt})
+		}
+	}
+	if differ {
+		conflict = alt
+	}
+	return
+}
+
+// settingAttrs are the attributes of the WebTest element, its settings
+func settingAttrs(wt WebTest) ([]xml.Attr, error) {
+	wt.Items, wt.Unknown = nil, nil
+	wt.DataSources, wt.ContextParameters = nil, nil
+	wt.ValidationRules, wt.WebTestPlugins = nil, nil
+	nodes, err := encodeXmlNodes(xml.Name{Local: "WebTest"}, &wt)
+	if err != nil {
+		return nil, err
+	}
+	return nodes[0].attr, nil
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Conflict writing
+
+// markConflicts replaces the placeholders in the element tree with the
+// two sides of their conflicts
+func (m *merger) markConflicts(n *xmlNode) error {
+	for i, c := range n.children {
+		index := -1
+		for _, a := range c.attr {
+			if strings.HasPrefix(a.Value, mergeToken) {
+				index, _ = strconv.Atoi(strings.TrimPrefix(a.Value, mergeToken))
+			}
+		}
+		if index < 0 || index >= len(m.conflicts) {
+			if err := m.markConflicts(c); err != nil {
+				return err
+			}
+			continue
+		}
+		out := m.conflicts[index]
+		conflict := &xmlNode{conflict: make([][]*xmlNode, 2)}
+		for side, entries := range [][]mergeEntry{out.ours, out.theirs} {
+			for _, e := range entries {
+				nodes, err := encodeXmlNodes(xml.Name{Local: e.name}, e.value)
+				if err != nil {
+					return err
+				}
+				conflict.conflict[side] = append(conflict.conflict[side], nodes...)
+			}
+		}
+		n.children[i] = conflict
+	}
+	return nil
+}
+
+// writeConflict writes the two sides of the conflict in between the
+// conflict markers
+func (n *xmlNode) writeConflict(w *bufio.Writer, indent, eol string, depth int) {
+	w.WriteString(mergeOurs + eol)
+	for _, c := range n.conflict[0] {
+		c.write(w, indent, eol, depth)
+	}
+	w.WriteString(mergeSep + eol)
+	for _, c := range n.conflict[1] {
+		c.write(w, indent, eol, depth)
+	}
+	w.WriteString(mergeTheirs + eol)
+}
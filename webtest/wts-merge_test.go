@@ -0,0 +1,154 @@
+package webtest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// mergeSource makes a web test of the settings, items and context
+// parameters, given as Name=Value pairs
+func mergeSource(settings, items string, params ...string) string {
+	cps := ""
+	for _, p := range params {
+		kv := strings.SplitN(p, "=", 2)
+		cps += `<ContextParameter Name="` + kv[0] + `" Value="` + kv[1] + `" />`
+	}
+	return `<WebTest Name="T" ` + settings + `><Items>` + items + `</Items>` +
+		`<ContextParameters>` + cps + `</ContextParameters></WebTest>`
+}
+
+// mergeReq makes a request of the guid and url
+func mergeReq(guid, url string) string {
+	return `<Request Method="GET" Guid="` + guid + `" Url="` + url + `" />`
+}
+
+// mergedUrls lists the urls of the requests, in transactions or not, and
+// the context parameters of the merged web test
+func mergedUrls(t *testing.T, merged string) (string, string) {
+	wt, err := Parse(strings.NewReader(merged))
+	if err != nil {
+		t.Fatalf("%v in\n%s", err, merged)
+	}
+	var urls, params []string
+	wt.Items.Walk("", func(r *Request, trans string) {
+		if len(trans) != 0 {
+			urls = append(urls, trans+":"+r.Url)
+			return
+		}
+		urls = append(urls, r.Url)
+	})
+	for _, p := range wt.ContextParameters {
+		params = append(params, p.Name+"="+p.Value)
+	}
+	return strings.Join(urls, " "), strings.Join(params, " ")
+}
+
+func TestMerge(t *testing.T) {
+	a, b, c := mergeReq("a", "/a"), mergeReq("b", "/b"), mergeReq("c", "/c")
+	trans := func(items string) string {
+		return `<TransactionTimer Name="T"><Items>` + items + `</Items></TransactionTimer>`
+	}
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		urls, params       string
+		attrs              []string
+	}{
+		{"added on each side",
+			mergeSource("", a+b), mergeSource("", a+c+b), mergeSource("", a+b+mergeReq("d", "/d")),
+			"/a /c /b /d", "", nil},
+		{"changed on one side, moved on the other",
+			mergeSource("", a+b), mergeSource("", b+a), mergeSource("", a+mergeReq("b", "/b2")),
+			"/b2 /a", "", nil},
+		{"removed on one side",
+			mergeSource("", a+b+c), mergeSource("", a+c), mergeSource("", a+b+c),
+			"/a /c", "", nil},
+		{"the same change on both sides",
+			mergeSource("", a), mergeSource("", mergeReq("a", "/x")), mergeSource("", mergeReq("a", "/x")),
+			"/x", "", nil},
+		{"within a transaction",
+			mergeSource("", trans(a)), mergeSource("", trans(a+b)), mergeSource("", trans(c+a)),
+			"T:/c T:/a T:/b", "", nil},
+		{"context parameters and settings",
+			mergeSource(`Owner="" Description=""`, a, "web=http://a/"),
+			mergeSource(`Owner="me" Description=""`, a, "web=http://a/", "user=bob"),
+			mergeSource(`Owner="" Description="d"`, a, "web=http://b/"),
+			"/a", "web=http://b/ user=bob", []string{`Owner="me"`, `Description="d"`}},
+	}
+	for _, tt := range tests {
+		base, ours, theirs := parseMerge(t, tt.base), parseMerge(t, tt.ours),
+			parseMerge(t, tt.theirs)
+		var buf bytes.Buffer
+		n, err := Merge(&buf, base, ours, theirs)
+		if err != nil || n != 0 {
+			t.Errorf("%s: %d conflicts, %v\n%s", tt.name, n, err, buf.String())
+			continue
+		}
+		urls, params := mergedUrls(t, buf.String())
+		if urls != tt.urls || params != tt.params {
+			t.Errorf("%s: got %q %q, want %q %q", tt.name, urls, params, tt.urls, tt.params)
+		}
+		for _, attr := range tt.attrs {
+			if !strings.Contains(buf.String(), attr) {
+				t.Errorf("%s: no %s in\n%s", tt.name, attr, buf.String())
+			}
+		}
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	a, b := mergeReq("a", "/a"), mergeReq("b", "/b")
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		conflicts          int
+		want               []string
+	}{
+		{"changed differently",
+			mergeSource("", a+b), mergeSource("", a+mergeReq("b", "/ours")),
+			mergeSource("", a+mergeReq("b", "/theirs")), 1,
+			[]string{"<<<<<<< ours\r\n    " + `<Request Method="GET" Guid="b" Version="" Url="/ours"`,
+				"=======\r\n    " + `<Request Method="GET" Guid="b" Version="" Url="/theirs"`}},
+		{"changed and removed",
+			mergeSource("", a+b), mergeSource("", a+mergeReq("b", "/ours")),
+			mergeSource("", a), 1,
+			[]string{`Url="/ours"`, `ReportingName="" />` + "\r\n=======\r\n>>>>>>> theirs\r\n"}},
+		{"settings changed differently",
+			mergeSource(`Owner=""`, a), mergeSource(`Owner="me"`, a),
+			mergeSource(`Owner="you"`, a), 1,
+			[]string{"<<<<<<< ours\r\n<WebTest Name=\"T\" Owner=\"me\" ",
+				"=======\r\n<WebTest Name=\"T\" Owner=\"you\" ", "\r\n>>>>>>> theirs\r\n  <Items>"}},
+		{"context parameter changed differently",
+			mergeSource("", a, "web=http://a/"), mergeSource("", a, "web=http://b/"),
+			mergeSource("", a, "web=http://c/"), 1,
+			[]string{`<ContextParameter Name="web" Value="http://b/" />` + "\r\n=======\r\n" +
+				`    <ContextParameter Name="web" Value="http://c/" />`}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		n, err := Merge(&buf, parseMerge(t, tt.base), parseMerge(t, tt.ours),
+			parseMerge(t, tt.theirs))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if n != tt.conflicts {
+			t.Errorf("%s: %d conflicts, want %d", tt.name, n, tt.conflicts)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s: no %q in\n%s", tt.name, want, buf.String())
+			}
+		}
+	}
+}
+
+// parseMerge parses the web test source of a merge
+func parseMerge(t *testing.T, source string) *WebTest {
+	wt, err := Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wt
+}
@@ -0,0 +1,117 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-param
+// Purpose: wts (web test script) web server parameterization
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// ParamOptions tells how to parameterize the web servers
+type ParamOptions struct {
+	// Prefix is of the context parameter names, WebServer by default
+	Prefix string
+}
+
+// HostParam is the context parameter of a web server, by its scheme+host
+type HostParam struct {
+	Name string
+	Host string
+}
+
+// hostRe matches the scheme+host prefix of a hard-coded Url
+var hostRe = regexp.MustCompile(`^(?i)https?://[^/?#{}]+`)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// ParamHosts replaces the scheme+host prefixes of all the request Urls,
+// dependent requests included, with context parameters, the way the
+// Visual Studio "Parameterize Web Servers" does. It tells the hosts
+// parameterized, in order of appearance
+func (wt *WebTest) ParamHosts(opt ParamOptions) []HostParam {
+	prefix := opt.Prefix
+	if len(prefix) == 0 {
+		prefix = "WebServer"
+	}
+	p := paramHosts(wt, prefix)
+	params := make([]HostParam, len(p.hosts))
+	for i, host := range p.hosts {
+		params[i] = HostParam{p.names[host], host}
+	}
+	return params
+}
+
+// hostParams maps the distinct hosts to their context parameter names
+type hostParams struct {
+	hosts []string // in order of appearance
+	names map[string]string
+}
+
+// paramHosts parameterizes the web servers with context parameters named
+// after the prefix. Existing context parameters of the same value are
+// reused
+func paramHosts(wt *WebTest, prefix string) hostParams {
+	p := hostParams{names: map[string]string{}}
+	taken := map[string]bool{}
+	for _, cp := range wt.ContextParameters {
+		taken[cp.Name] = true
+		if hostRe.FindString(cp.Value) == strings.TrimRight(cp.Value, "/") {
+			p.names[strings.TrimRight(cp.Value, "/")] = cp.Name
+		}
+	}
+
+	param := func(url string) string {
+		host := hostRe.FindString(url)
+		if len(host) == 0 {
+			return url
+		}
+		name, ok := p.names[host]
+		if !ok {
+			for i := 1; ; i++ {
+				name = fmt.Sprintf("%s%d", prefix, i)
+				if !taken[name] {
+					break
+				}
+			}
+			taken[name] = true
+			p.names[host] = name
+			wt.ContextParameters = append(wt.ContextParameters,
+				ContextParameter{Name: name, Value: host})
+		}
+		if !paramSeen(p.hosts, host) {
+			p.hosts = append(p.hosts, host)
+		}
+		return "{{" + name + "}}" + url[len(host):]
+	}
+
+	var fix func(r *Request)
+	fix = func(r *Request) {
+		r.Url = param(r.Url)
+		if len(r.ExpectedResponseUrl) != 0 {
+			r.ExpectedResponseUrl = param(r.ExpectedResponseUrl)
+		}
+		for _, d := range r.DependentRequests {
+			fix(d)
+		}
+	}
+	wt.Items.Walk("", func(r *Request, trans string) { fix(r) })
+	return p
+}
+
+func paramSeen(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package webtest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParamHosts(t *testing.T) {
+	req := func(url, attrs, inner string) string {
+		return testRequest("GET", "g", url, attrs, inner)
+	}
+	cp := func(name, value string) string {
+		return `<ContextParameter Name="` + name + `" Value="` + value + `" />`
+	}
+	tests := []struct {
+		name, items, params string
+		urls, want          string
+	}{
+		{"distinct hosts in order",
+			req("http://b.example.com/x", "", "") + req("https://a.example.com:8443/y?q=1", "", "") +
+				req("http://b.example.com/z", "", ""), "",
+			"{{WebServer1}}/x {{WebServer2}}/y?q=1 {{WebServer1}}/z",
+			"WebServer1=http://b.example.com WebServer2=https://a.example.com:8443"},
+		{"context parameter reused, its name skipped",
+			req("http://a.example.com/x", "", "") + req("http://b.example.com/", "", ""),
+			cp("Web", "http://a.example.com/") + cp("WebServer1", "other"),
+			"{{Web}}/x {{WebServer2}}/",
+			"Web=http://a.example.com/ WebServer1=other WebServer2=http://b.example.com"},
+		{"already parameterized", req("{{web}}/x", "", ""), "", "{{web}}/x", ""},
+		{"dependent requests and transactions",
+			`<TransactionTimer Name="T"><Items>` +
+				req("http://a.example.com/x", `ExpectedResponseUrl="http://a.example.com/y"`,
+					"<DependentRequests>"+req("HTTP://c.example.com/logo.png", "", "")+
+						"</DependentRequests>") + `</Items></TransactionTimer>`, "",
+			"{{WebServer1}}/x {{WebServer2}}/logo.png",
+			"WebServer1=http://a.example.com WebServer2=HTTP://c.example.com"},
+	}
+	for _, tt := range tests {
+		source := testWebTest(tt.items)
+		if len(tt.params) != 0 {
+			source = strings.Replace(source, "</WebTest>",
+				"<ContextParameters>"+tt.params+"</ContextParameters></WebTest>", 1)
+		}
+		wt, err := Parse(strings.NewReader(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wt.ParamHosts(ParamOptions{})
+
+		var urls, params []string
+		var walk func(r *Request)
+		walk = func(r *Request) {
+			urls = append(urls, r.Url)
+			for _, d := range r.DependentRequests {
+				walk(d)
+			}
+		}
+		for _, item := range wt.Items {
+			switch v := item.(type) {
+			case *Request:
+				walk(v)
+			case *TransactionTimer:
+				r := v.Items[0].(*Request)
+				walk(r)
+				if r.ExpectedResponseUrl != "{{WebServer1}}/y" {
+					t.Errorf("%s: ExpectedResponseUrl %s", tt.name, r.ExpectedResponseUrl)
+				}
+			}
+		}
+		for _, p := range wt.ContextParameters {
+			params = append(params, p.Name+"="+p.Value)
+		}
+		if got := strings.Join(urls, " "); got != tt.urls {
+			t.Errorf("%s: urls %s, want %s", tt.name, got, tt.urls)
+		}
+		if got := strings.Join(params, " "); got != tt.want {
+			t.Errorf("%s: context parameters %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,818 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-run
+// Purpose: wts (web test script) running with the Go HTTP client
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package webtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// RunOptions tells how to run the web tests
+type RunOptions struct {
+	// Params set the context parameters, over the ones of the web test,
+	// e.g. to point the WebServer1 to a test server
+	Params map[string]string
+	// NoThinkTime runs the requests without waiting their ThinkTime
+	NoThinkTime bool
+	// Dir is where the included web tests, the data source and upload
+	// files are looked for, normally the directory of the web test
+	Dir string
+	// Transport sends the requests, http.DefaultTransport if not given
+	Transport http.RoundTripper
+	// MaxIterations is the safety cap of the Loops without MaxIterations,
+	// or of -1, which fail when it is reached. DefaultMaxIterations if 0
+	MaxIterations int
+	// Timeout is of the requests without Timeout, or of 0,
+	// DefaultTimeout if not given
+	Timeout time.Duration
+}
+
+const (
+	// DefaultMaxIterations is the safety cap of the unbounded Loops
+	DefaultMaxIterations = 1000
+	// DefaultTimeout is the Timeout Visual Studio gives to a new request
+	DefaultTimeout = 300 * time.Second
+)
+
+// RequestResult is the outcome of running a request
+type RequestResult struct {
+	Request  *Request
+	Url      string // with the context parameters substituted
+	Status   int
+	Duration time.Duration
+	Cached   bool // not sent again, for Cache="True"
+	// Failures tell why the request failed, none if it passed
+	Failures []string
+	// Notes tell what is skipped, the rules and plugins not supported
+	Notes []string
+}
+
+// RunResult is the outcome of running a web test
+type RunResult struct {
+	Requests []*RequestResult // dependent requests included
+	Failed   int
+}
+
+// Runner runs the web tests. The context parameters, cookies and cache
+// are kept for the run of a single web test
+type Runner struct {
+	opt         RunOptions
+	client      *http.Client
+	context     map[string]string
+	cached      map[string]bool
+	rules       []ValidationRule // of the WebTest, for every request
+	stopOnError bool
+	stop        bool // a request failed on StopOnError
+	result      *RunResult
+	w           *nestWriter
+}
+
+var ctxRefRe = regexp.MustCompile(`\{\{([^{}]+)\}\}`)
+var htmlInputRe = regexp.MustCompile(`(?i)<input\b[^>]*>`)
+var htmlAttrRe = regexp.MustCompile(
+	`([\w:.-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// NewRunner makes the runner of the web tests, with the opt settings
+func NewRunner(opt RunOptions) *Runner {
+	if opt.MaxIterations <= 0 {
+		opt.MaxIterations = DefaultMaxIterations
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = DefaultTimeout
+	}
+	return &Runner{opt: opt}
+}
+
+// Run runs the web test, writing the outcome of each request to w, in the
+// style of the dump. The error is for what stops the web test from running
+// on, while the failed requests are told in the RunResult
+func (rn *Runner) Run(w io.Writer, wt *WebTest) (*RunResult, error) {
+	transport := rn.opt.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	jar, _ := cookiejar.New(nil)
+	rn.client = &http.Client{Transport: transport, Jar: jar}
+	rn.context = map[string]string{}
+	rn.cached = map[string]bool{}
+	rn.rules = wt.ValidationRules
+	rn.stopOnError, rn.stop = wt.StopOnError == "True", false
+	rn.result = &RunResult{}
+	rn.w = &nestWriter{w: w}
+
+	for _, p := range wt.WebTestPlugins {
+		fmt.Fprintf(rn.w, "WP: (%s) not supported, skipped\r\n", p.DisplayName)
+	}
+	for _, p := range wt.ContextParameters {
+		rn.context[p.Name] = p.Value
+	}
+	for k, v := range rn.opt.Params {
+		rn.context[k] = v
+	}
+	if err := rn.dataSources(wt.DataSources); err != nil {
+		return rn.result, err
+	}
+	return rn.result, rn.items(wt.Items)
+}
+
+// Passed tells whether the request passed
+func (r *RequestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *RequestResult) fail(format string, a ...interface{}) {
+	r.Failures = append(r.Failures, fmt.Sprintf(format, a...))
+}
+
+func (r *RequestResult) note(format string, a ...interface{}) {
+	r.Notes = append(r.Notes, fmt.Sprintf(format, a...))
+}
+
+// outcome is how the request went, for the end of its G:/P: line
+func (r *RequestResult) outcome() string {
+	verdict := "Pass"
+	if !r.Passed() {
+		verdict = "Fail"
+	}
+	switch {
+	case r.Cached:
+		return "cached: " + verdict
+	case r.Status == 0:
+		return verdict
+	}
+	return fmt.Sprintf("%d in %dms: %s", r.Status,
+		r.Duration/time.Millisecond, verdict)
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Item-level running
+
+// items runs the items in order, till a request fails on StopOnError
+func (rn *Runner) items(items Items) error {
+	for _, item := range items {
+		if rn.stop {
+			return nil
+		}
+		switch t := item.(type) {
+		case *Comment:
+			fmt.Fprintf(rn.w, "C: %s\r\n", t.CommentText)
+		case *Request:
+			var buf bytes.Buffer
+			rn.request(&buf, t)
+			buf.WriteString("\r\n")
+			rn.w.Write(buf.Bytes())
+		case *TransactionTimer:
+			fmt.Fprintf(rn.w, "\r\nT: %s\r\n", t.Name)
+			start := time.Now()
+			if err := rn.nested(t.Items); err != nil {
+				return err
+			}
+			fmt.Fprintf(rn.w, "TE: %s (%dms)\r\n\r\n", t.Name,
+				time.Since(start)/time.Millisecond)
+		case *Condition:
+			ok, err := rn.condition(t.ConditionalRule)
+			if err != nil {
+				return err
+			}
+			branch := t.Then
+			if ok {
+				fmt.Fprintf(rn.w, "CB: (%s) True\r\n", t.ConditionalRule.DisplayName)
+			} else {
+				fmt.Fprintf(rn.w, "CB: (%s) False\r\n", t.ConditionalRule.DisplayName)
+				branch = t.Else
+				if branch != nil && len(branch.Items) != 0 {
+					fmt.Fprintf(rn.w, "CE: \r\n")
+				}
+			}
+			if branch != nil {
+				if err := rn.nested(branch.Items); err != nil {
+					return err
+				}
+			}
+		case *Loop:
+			max, _ := strconv.Atoi(t.ConditionalRule.maxIterations())
+			for i := 0; max <= 0 || i < max; i++ {
+				ok, err := rn.loop(t.ConditionalRule, i)
+				if err != nil {
+					return err
+				}
+				if !ok || rn.stop {
+					break
+				}
+				if max <= 0 && i == rn.opt.MaxIterations {
+					return fmt.Errorf("%s: loop not ended after %d iterations",
+						t.ConditionalRule.DisplayName, i)
+				}
+				fmt.Fprintf(rn.w, "LP: (%s) #%d\r\n",
+					t.ConditionalRule.DisplayName, i+1)
+				if err := rn.nested(t.Items); err != nil {
+					return err
+				}
+			}
+		case *IncludedWebTest:
+			fmt.Fprintf(rn.w, "I: %s\r\n", t.Name)
+			if err := rn.include(t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nested runs the items within a transaction, condition, loop or included
+// web test, indented one more level
+func (rn *Runner) nested(items Items) error {
+	rn.w.depth++
+	defer func() { rn.w.depth-- }()
+	return rn.items(items)
+}
+
+// include runs the items of the included web test, with the same context
+func (rn *Runner) include(t *IncludedWebTest) error {
+	path := t.Path
+	if len(path) == 0 {
+		path = t.Name + ".webtest"
+	}
+	f, err := os.Open(rn.path(path))
+	if err != nil {
+		return fmt.Errorf("included web test %s: %v", t.Name, err)
+	}
+	wt, err := Parse(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("included web test %s: %v", t.Name, err)
+	}
+	for _, p := range wt.ContextParameters {
+		if _, found := rn.context[p.Name]; !found {
+			rn.context[p.Name] = p.Value
+		}
+	}
+	return rn.nested(wt.Items)
+}
+
+// dataSources binds the first row of the CSV data sources to the context,
+// the way a single iteration run does
+func (rn *Runner) dataSources(sources []DataSource) error {
+	for _, ds := range sources {
+		if !strings.HasSuffix(ds.Provider, ".CSV") {
+			fmt.Fprintf(rn.w, "DS: (%s) not supported, skipped\r\n", ds.Name)
+			continue
+		}
+		path := strings.Replace(ds.Connection, "|DataDirectory|", "", 1)
+		f, err := os.Open(rn.path(strings.TrimLeft(path, `\/`)))
+		if err != nil {
+			return fmt.Errorf("data source %s: %v", ds.Name, err)
+		}
+		rows, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("data source %s: %v", ds.Name, err)
+		}
+		if len(rows) < 2 {
+			continue
+		}
+		for _, t := range ds.Tables {
+			for i, col := range rows[0] {
+				if i < len(rows[1]) {
+					rn.context[ds.Name+"."+t.Name+"."+col] = rows[1][i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// path is the file path of the name in the web test, relative to the
+// opt.Dir, with the Windows separators
+func (rn *Runner) path(name string) string {
+	p := filepath.FromSlash(strings.Replace(name, `\`, "/", -1))
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(rn.opt.Dir, p)
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Conditions and loops
+
+// condition evaluates the conditional rule of a Condition, or of a Loop
+// working as a while loop
+func (rn *Runner) condition(rule *ConditionalRule) (bool, error) {
+	if rule == nil {
+		return false, fmt.Errorf("condition without a conditional rule")
+	}
+	p := ruleParams(rule.RuleParameters)
+	value, found := rn.context[p["ContextParameterName"]]
+	switch ruleClass(rule.Classname) {
+	case "NumericalComparisonRule":
+		return compareNumbers(value, p["ComparisonOperator"], p["Value"])
+	case "StringComparisonRule":
+		want := p["Value"]
+		if p["IgnoreCase"] == "True" {
+			value, want = strings.ToLower(value), strings.ToLower(want)
+		}
+		switch p["ComparisonOperator"] {
+		case "Equality", "==":
+			return found && value == want, nil
+		case "Inequality", "!=":
+			return !found || value != want, nil
+		case "Contains":
+			return found && strings.Contains(value, want), nil
+		case "NotContains":
+			return !found || !strings.Contains(value, want), nil
+		}
+		return false, fmt.Errorf("%s: unknown comparison operator '%s'",
+			rule.DisplayName, p["ComparisonOperator"])
+	case "ContextParameterExistenceRule":
+		return found == (p["CheckForExistence"] != "False"), nil
+	case "ProbabilityRule":
+		percentage, _ := strconv.ParseFloat(p["Percentage"], 64)
+		return rand.Float64()*100 < percentage, nil
+	}
+	return false, fmt.Errorf("conditional rule %s not supported", rule.DisplayName)
+}
+
+// loop evaluates the conditional rule of a Loop before its ith iteration,
+// counting from 0
+func (rn *Runner) loop(rule *ConditionalRule, i int) (bool, error) {
+	if rule == nil {
+		return false, fmt.Errorf("loop without a conditional rule")
+	}
+	p := ruleParams(rule.RuleParameters)
+	switch ruleClass(rule.Classname) {
+	case "ForLoopRule":
+		name := p["ContextParameterName"]
+		n, _ := strconv.ParseFloat(p["InitialValue"], 64)
+		if i > 0 {
+			n, _ = strconv.ParseFloat(rn.context[name], 64)
+			inc, _ := strconv.ParseFloat(p["IncrementValue"], 64)
+			n += inc
+		}
+		rn.context[name] = strconv.FormatFloat(n, 'f', -1, 64)
+		return compareNumbers(rn.context[name], p["ComparisonOperator"],
+			p["TerminatingValue"])
+	case "CountingLoopRule":
+		count, _ := strconv.Atoi(p["IterationsCount"])
+		return i < count, nil
+	}
+	return rn.condition(rule)
+}
+
+// maxIterations is the MaxIterations of the rule, -1 for no limit
+func (rule *ConditionalRule) maxIterations() string {
+	if rule == nil || len(rule.MaxIterations) == 0 {
+		return "-1"
+	}
+	return rule.MaxIterations
+}
+
+// compareNumbers compares the two numbers, which is false if either is not
+func compareNumbers(a, op, b string) (bool, error) {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return false, fmt.Errorf("unknown comparison operator '%s'", op)
+	}
+	if errA != nil || errB != nil {
+		return false, nil
+	}
+	switch op {
+	case "==":
+		return x == y, nil
+	case "!=":
+		return x != y, nil
+	case "<":
+		return x < y, nil
+	case "<=":
+		return x <= y, nil
+	case ">":
+		return x > y, nil
+	}
+	return x >= y, nil
+}
+
+// ruleClass is the short class name of the rule, e.g., ExtractText of
+// "Microsoft.VisualStudio.TestTools.WebTesting.Rules.ExtractText, ..."
+func ruleClass(classname string) string {
+	c := strings.TrimSpace(strings.SplitN(classname, ",", 2)[0])
+	return c[strings.LastIndex(c, ".")+1:]
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Request running
+
+// request runs the request and then its dependent requests, writing their
+// outcome to w, each line of the dependent requests prefixed with "  D: "
+func (rn *Runner) request(w *bytes.Buffer, r *Request) {
+	res := rn.send(r)
+	rn.result.Requests = append(rn.result.Requests, res)
+	if !res.Passed() {
+		rn.result.Failed++
+		rn.stop = rn.stopOnError
+	}
+
+	switch r.Method {
+	case "GET", "":
+		fmt.Fprintf(w, "G: (%s,%s) %s (%s): %s\r\n",
+			r.ThinkTime, r.Timeout, res.Url, r.ReportingName, res.outcome())
+	case "POST":
+		fmt.Fprintf(w, "P: (%s,%s) %s (%s): %s\r\n",
+			r.ThinkTime, r.Timeout, res.Url, r.ReportingName, res.outcome())
+	default:
+		fmt.Fprintf(w, "M: %s (%s,%s) %s (%s): %s\r\n", r.Method,
+			r.ThinkTime, r.Timeout, res.Url, r.ReportingName, res.outcome())
+	}
+	for _, f := range res.Failures {
+		fmt.Fprintf(w, "  !: %s\r\n", f)
+	}
+	for _, n := range res.Notes {
+		fmt.Fprintf(w, "  ?: %s\r\n", n)
+	}
+
+	for _, d := range r.DependentRequests {
+		dw := bytes.NewBuffer([]byte{})
+		rn.request(dw, d)
+		w.WriteString(dependentLines(dw.String()))
+	}
+	if thinkTime, _ := strconv.Atoi(r.ThinkTime); thinkTime > 0 &&
+		!rn.opt.NoThinkTime && !res.Cached {
+		time.Sleep(time.Duration(thinkTime) * time.Second)
+	}
+}
+
+// send sends the request, and extracts from and validates the response
+func (rn *Runner) send(r *Request) *RequestResult {
+	res := &RequestResult{Request: r}
+	method := r.Method
+	if len(method) == 0 {
+		method = "GET"
+	}
+	res.Url = rn.substitute(res, r.Url)
+	if len(r.QueryStringParameters) != 0 {
+		var q []string
+		for _, p := range r.QueryStringParameters {
+			q = append(q, formParam(p.Name, rn.substitute(res, p.Value),
+				p.UrlEncode))
+		}
+		sep := "?"
+		if strings.Contains(res.Url, "?") {
+			sep = "&"
+		}
+		res.Url += sep + strings.Join(q, "&")
+	}
+	if method == "GET" && r.Cache == "True" && rn.cached[res.Url] {
+		res.Cached = true
+		return res
+	}
+	for _, p := range r.RequestPlugins {
+		res.note("%s: plugin not supported, skipped", p.DisplayName)
+	}
+
+	body, contentType, err := rn.body(res, r)
+	if err != nil {
+		res.fail("%v", err)
+	}
+	// not sent with the context parameters missing
+	if !res.Passed() {
+		return res
+	}
+	timeout := rn.opt.Timeout
+	if t, _ := strconv.Atoi(r.Timeout); t > 0 {
+		timeout = time.Duration(t) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequest(method, res.Url, body)
+	if err != nil {
+		res.fail("%v", err)
+		return res
+	}
+	req = req.WithContext(ctx)
+	if len(contentType) != 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for _, h := range r.Headers {
+		if strings.EqualFold(h.Name, "Host") {
+			req.Host = rn.substitute(res, h.Value)
+			continue
+		}
+		req.Header.Set(h.Name, rn.substitute(res, h.Value))
+	}
+	client := *rn.client
+	if r.FollowRedirects == "False" {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		res.Duration = time.Since(start)
+		res.fail("%v", err)
+		return res
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	res.Duration = time.Since(start)
+	res.Status = resp.StatusCode
+	if err != nil {
+		res.fail("%v", err)
+		return res
+	}
+
+	expected, _ := strconv.Atoi(r.ExpectedHttpStatusCode)
+	switch {
+	case r.IgnoreHttpStatusCode == "True":
+	case expected != 0 && res.Status != expected:
+		res.fail("status %d, expected %d", res.Status, expected)
+	case expected == 0 && res.Status >= 400:
+		res.fail("status %d", res.Status)
+	}
+	page := string(content)
+	for _, e := range r.ExtractionRules {
+		rn.extract(res, e, resp, page)
+	}
+	rules := append([]ValidationRule{}, r.ValidationRules...)
+	for _, v := range append(rules, rn.rules...) {
+		rn.validate(res, r, v, resp, page)
+	}
+	if method == "GET" && res.Passed() {
+		rn.cached[res.Url] = true
+	}
+	return res
+}
+
+// substitute replaces the {{context}} parameters in s with their values
+func (rn *Runner) substitute(res *RequestResult, s string) string {
+	return ctxRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		if v, found := rn.context[ref[2:len(ref)-2]]; found {
+			return v
+		}
+		res.fail("context parameter %s not found", ref)
+		return ref
+	})
+}
+
+// body makes the request body, of the form post, string or binary body,
+// and tells its content type
+func (rn *Runner) body(res *RequestResult, r *Request) (io.Reader, string, error) {
+	switch {
+	case r.FormPostHttpBody != nil &&
+		len(r.FormPostHttpBody.FileUploadParameter) != 0:
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, p := range r.FormPostHttpBody.FormPostParameter {
+			mw.WriteField(p.Name, rn.substitute(res, p.Value))
+		}
+		for _, f := range r.FormPostHttpBody.FileUploadParameter {
+			name := rn.substitute(res, f.FileName)
+			content, err := ioutil.ReadFile(rn.path(name))
+			if err != nil {
+				return nil, "", err
+			}
+			h := textproto.MIMEHeader{}
+			h.Set("Content-Disposition", fmt.Sprintf(
+				`form-data; name="%s"; filename="%s"`, f.Name, filepath.Base(name)))
+			h.Set("Content-Type", f.ContentType)
+			pw, err := mw.CreatePart(h)
+			if err != nil {
+				return nil, "", err
+			}
+			pw.Write(content)
+		}
+		mw.Close()
+		return &buf, mw.FormDataContentType(), nil
+	case r.FormPostHttpBody != nil:
+		var q []string
+		for _, p := range r.FormPostHttpBody.FormPostParameter {
+			q = append(q, formParam(p.Name, rn.substitute(res, p.Value),
+				p.UrlEncode))
+		}
+		return strings.NewReader(strings.Join(q, "&")),
+			"application/x-www-form-urlencoded", nil
+	case r.StringHttpBody != nil:
+		s := rn.substitute(res, DecodeStringBody(r.StringBody()))
+		b, err := encodeText(s, r.Encoding,
+			r.StringHttpBody.InsertByteOrderMark == "True")
+		return bytes.NewReader(b), r.StringHttpBody.ContentType, err
+	case r.BinaryHttpBody != nil:
+		b, err := base64.StdEncoding.DecodeString(
+			strings.TrimSpace(r.BinaryHttpBody.Data))
+		return bytes.NewReader(b), r.BinaryHttpBody.ContentType, err
+	}
+	return nil, "", nil
+}
+
+// formParam is the name=value of a query string or form post parameter
+func formParam(name, value, urlEncode string) string {
+	if urlEncode == "False" {
+		return url.QueryEscape(name) + "=" + value
+	}
+	return url.QueryEscape(name) + "=" + url.QueryEscape(value)
+}
+
+// encodeText encodes the request body text in the request Encoding
+func encodeText(s, encoding string, bom bool) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "", "utf-8":
+		if bom {
+			return append([]byte("\xef\xbb\xbf"), s...), nil
+		}
+		return []byte(s), nil
+	case "utf-16", "unicode":
+		if bom {
+			return append([]byte("\xff\xfe"), EncodeUTF16(s)...), nil
+		}
+		return EncodeUTF16(s), nil
+	case "us-ascii", "iso-8859-1":
+		limit := rune(0xff)
+		if strings.ToLower(encoding) == "us-ascii" {
+			limit = 0x7f
+		}
+		b := make([]byte, 0, len(s))
+		for _, c := range s {
+			if c > limit {
+				c = '?'
+			}
+			b = append(b, byte(c))
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("encoding %s not supported", encoding)
+}
+
+//::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::::
+// Extraction and validation rules
+
+// extract runs the extraction rule on the response, setting the context
+// parameter of it
+func (rn *Runner) extract(res *RequestResult, e ExtractionRule,
+	resp *http.Response, page string) {
+	p := ruleParams(e.RuleParameters)
+	value, found := "", false
+	switch ruleClass(e.Classname) {
+	case "ExtractHiddenFields":
+		for _, input := range htmlInputs(page) {
+			if strings.EqualFold(input["type"], "hidden") && len(input["name"]) != 0 {
+				rn.context["$HIDDEN"+e.VariableName+"."+input["name"]] = input["value"]
+				found = true
+			}
+		}
+		if !found && p["Required"] == "True" {
+			res.fail("%s: no hidden field found", e.DisplayName)
+		}
+		return
+	case "ExtractFormField":
+		for _, input := range htmlInputs(page) {
+			if input["name"] == p["Name"] {
+				value, found = input["value"], true
+				break
+			}
+		}
+	case "ExtractHttpHeader":
+		_, found = resp.Header[http.CanonicalHeaderKey(p["Header"])]
+		value = resp.Header.Get(p["Header"])
+	case "ExtractText":
+		expr := regexp.QuoteMeta(p["StartsWith"]) + "(.*?)" +
+			regexp.QuoteMeta(p["EndsWith"])
+		if p["UseRegularExpression"] == "True" {
+			expr = p["StartsWith"] + "(.*?)" + p["EndsWith"]
+		}
+		value, found = extractMatch(res, e.DisplayName, expr, page, p, 1)
+	case "ExtractRegularExpression":
+		value, found = extractMatch(res, e.DisplayName, p["RegularExpression"],
+			page, p, 0)
+	default:
+		res.note("%s: extraction rule not supported, skipped", e.DisplayName)
+		return
+	}
+	if !found {
+		if p["Required"] == "True" {
+			res.fail("%s: nothing extracted for %s", e.DisplayName, e.VariableName)
+		}
+		return
+	}
+	if p["HtmlDecode"] == "True" {
+		value = html.UnescapeString(value)
+	}
+	rn.context[e.VariableName] = value
+}
+
+// extractMatch finds the Index-th match of the expr in the page, and takes
+// the group of it
+func extractMatch(res *RequestResult, rule, expr, page string,
+	p map[string]string, group int) (string, bool) {
+	expr = "(?s)" + expr
+	if p["IgnoreCase"] == "True" {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		res.fail("%s: %v", rule, err)
+		return "", false
+	}
+	index, _ := strconv.Atoi(p["Index"])
+	matches := re.FindAllStringSubmatch(page, index+1)
+	if index < 0 || index >= len(matches) || group >= len(matches[index]) {
+		return "", false
+	}
+	return matches[index][group], true
+}
+
+// htmlInputs are the attributes of the <input> elements of the page
+func htmlInputs(page string) []map[string]string {
+	var inputs []map[string]string
+	for _, tag := range htmlInputRe.FindAllString(page, -1) {
+		attrs := map[string]string{}
+		for _, m := range htmlAttrRe.FindAllStringSubmatch(tag[len("<input"):], -1) {
+			attrs[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+		}
+		inputs = append(inputs, attrs)
+	}
+	return inputs
+}
+
+// validate runs the validation rule on the response
+func (rn *Runner) validate(res *RequestResult, r *Request, v ValidationRule,
+	resp *http.Response, page string) {
+	p := ruleParams(v.RuleParameters)
+	switch ruleClass(v.Classname) {
+	case "ValidationRuleFindText":
+		text := p["FindText"]
+		var found bool
+		switch {
+		case p["UseRegularExpression"] == "True":
+			expr := text
+			if p["IgnoreCase"] == "True" {
+				expr = "(?i)" + expr
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				res.fail("%s: %v", v.DisplayName, err)
+				return
+			}
+			found = re.MatchString(page)
+		case p["IgnoreCase"] == "True":
+			found = strings.Contains(strings.ToLower(page), strings.ToLower(text))
+		default:
+			found = strings.Contains(page, text)
+		}
+		if want := p["PassIfTextFound"] != "False"; found != want {
+			what := "not found"
+			if found {
+				what = "found"
+			}
+			res.fail("%s: '%s' %s", v.DisplayName, text, what)
+		}
+	case "ValidationRuleResponseTimeGoal":
+		goal, _ := strconv.ParseFloat(r.ResponseTimeGoal, 64)
+		tolerance, _ := strconv.ParseFloat(p["Tolerance"], 64)
+		if goal > 0 && res.Duration.Seconds() > goal*(1+tolerance/100) {
+			res.fail("%s: %dms, over the goal of %ss", v.DisplayName,
+				res.Duration/time.Millisecond, r.ResponseTimeGoal)
+		}
+	case "ValidateResponseUrl":
+		// only the path is compared, the server is often a different one
+		if len(r.ExpectedResponseUrl) == 0 {
+			return
+		}
+		expected, err := url.Parse(rn.substitute(res, r.ExpectedResponseUrl))
+		if err == nil && expected.Path != resp.Request.URL.Path {
+			res.fail("%s: %s, expected %s", v.DisplayName,
+				resp.Request.URL.Path, expected.Path)
+		}
+	default:
+		res.note("%s: validation rule not supported, skipped", v.DisplayName)
+	}
+}
@@ -0,0 +1,217 @@
+package webtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer serves a login page with a hidden token and a session header,
+// an account page needing both, and the items and their static files
+func testServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Session", "s1")
+		fmt.Fprint(w, `<form><input type="hidden" name="token" value="t1" /></form>`)
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != "t1" || r.Header.Get("X-Session") != "s1" {
+			http.Error(w, "not logged on", http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `Welcome <b>id=7</b>`)
+	})
+	mux.HandleFunc("/item/7", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `Item 7`)
+	})
+	mux.HandleFunc("/static/a.css", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `body {}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+// runReq makes a GET request of the url, with the inner elements
+func runReq(url, inner string) string {
+	return `<Request Method="GET" Guid="g" Url="{{web}}` + url +
+		`" ThinkTime="0">` + inner + `</Request>`
+}
+
+// runRule makes a rule element of the tag and class, with the attributes
+// and the Name=Value parameters
+func runRule(tag, class, attrs string, params ...string) string {
+	rps := ""
+	for _, p := range params {
+		kv := strings.SplitN(p, "=", 2)
+		rps += `<RuleParameter Name="` + kv[0] + `" Value="` + kv[1] + `" />`
+	}
+	return `<` + tag + ` Classname="Microsoft.VisualStudio.TestTools.WebTesting.Rules.` +
+		class + `, Microsoft.VisualStudio.QualityTools.WebTestFramework" ` + attrs +
+		`><RuleParameters>` + rps + `</RuleParameters></` + tag + `>`
+}
+
+func TestRun(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+
+	login := runReq("/login", `<ExtractionRules>`+
+		runRule("ExtractionRule", "ExtractHiddenFields", `VariableName="1" DisplayName="Hidden"`,
+			"Required=True")+
+		runRule("ExtractionRule", "ExtractHttpHeader", `VariableName="session" DisplayName="Session"`,
+			"Header=X-Session", "Required=True")+
+		`</ExtractionRules>`)
+	account := func(rules string) string {
+		return runReq("/account?token={{$HIDDEN1.token}}",
+			`<Headers><Header Name="X-Session" Value="{{session}}" /></Headers>`+
+				`<ExtractionRules>`+
+				runRule("ExtractionRule", "ExtractText", `VariableName="id" DisplayName="Id"`,
+					"StartsWith=id=", "EndsWith=&lt;/b&gt;", "Required=True")+
+				`</ExtractionRules>`+rules)
+	}
+	findText := func(text string) string {
+		return `<ValidationRules>` +
+			runRule("ValidationRule", "ValidationRuleFindText", `DisplayName="Find Text"`,
+				"FindText="+text, "PassIfTextFound=True") + `</ValidationRules>`
+	}
+	item := runReq("/item/{{id}}", `<DependentRequests>`+
+		runReq("/static/a.css", "")+runReq("/static/none.css", "")+`</DependentRequests>`)
+
+	tests := []struct {
+		name     string
+		settings string
+		items    string
+		failed   int
+		want     []string // the path, status and failures of each request
+	}{
+		{"extracted into the next requests", "",
+			login + account(findText("Welcome")) + item, 1,
+			[]string{"/login 200", "/account?token=t1 200", "/item/7 200",
+				"/static/a.css 200", "/static/none.css 404 status 404"}},
+		{"validation failure", "",
+			login + account(findText("Goodbye")) + item, 2,
+			[]string{"/login 200", "/account?token=t1 200 Find Text: 'Goodbye' not found",
+				"/item/7 200", "/static/a.css 200", "/static/none.css 404 status 404"}},
+		{"nothing to extract", "",
+			account("") + item, 3,
+			[]string{"/account?token={{$HIDDEN1.token}} 0 context parameter {{$HIDDEN1.token}} not found",
+				"/item/{{id}} 0 context parameter {{id}} not found",
+				"/static/a.css 200", "/static/none.css 404 status 404"}},
+		{"stopped on error", `StopOnError="True"`,
+			login + account(findText("Goodbye")) + item, 1,
+			[]string{"/login 200", "/account?token=t1 200 Find Text: 'Goodbye' not found"}},
+	}
+	for _, tt := range tests {
+		wt, err := Parse(strings.NewReader(`<WebTest Name="T" ` + tt.settings +
+			`><Items>` + tt.items + `</Items></WebTest>`))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var buf bytes.Buffer
+		res, err := NewRunner(RunOptions{Params: map[string]string{"web": srv.URL}}).Run(&buf, wt)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, r := range res.Requests {
+			got = append(got, strings.TrimSpace(fmt.Sprintf("%s %d %s",
+				strings.TrimPrefix(r.Url, srv.URL), r.Status, strings.Join(r.Failures, "; "))))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") || res.Failed != tt.failed {
+			t.Errorf("%s: got %d failed\n%s\nwant %d failed\n%s\nrun\n%s", tt.name,
+				res.Failed, strings.Join(got, "\n"), tt.failed, strings.Join(tt.want, "\n"), buf.String())
+		}
+	}
+}
+
+func TestRunOutput(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+
+	wt, err := Parse(strings.NewReader(string(webTestOf(`<Comment CommentText="c" />` +
+		`<TransactionTimer Name="T"><Items>` + runReq("/login", `<DependentRequests>`+
+		runReq("/static/none.css", "")+`</DependentRequests>`) +
+		`</Items></TransactionTimer>`))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := NewRunner(RunOptions{Params: map[string]string{"web": srv.URL}}).Run(&buf, wt); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"C: c\r\n", "\r\nT: T\r\n",
+		"  G: (0,) " + srv.URL + "/login (): 200 in ",
+		"  D: G: (0,) " + srv.URL + "/static/none.css (): 404 in ",
+		"  D:   !: status 404\r\n", "TE: T ("} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("no %q in\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	slow := httptest.NewServer(mux)
+	defer slow.Close()
+
+	// a while loop on the context parameter that is always there
+	loop := func(attrs string) string {
+		return `<Loop UniqueStringId="l1">` +
+			runRule("ConditionalRule", "ContextParameterExistenceRule",
+				`DisplayName="Context Parameter Exists" `+attrs,
+				"ContextParameterName=web", "CheckForExistence=True") +
+			`<Items>` + runReq("/item/7", "") + `</Items></Loop>`
+	}
+	tests := []struct {
+		name   string
+		items  string
+		opt    RunOptions
+		err    string
+		count  int // of the requests
+		failed int
+	}{
+		{"no MaxIterations", loop(""), RunOptions{MaxIterations: 3},
+			"Context Parameter Exists: loop not ended after 3 iterations", 3, 0},
+		{"MaxIterations of -1", loop(`MaxIterations="-1"`), RunOptions{MaxIterations: 2},
+			"Context Parameter Exists: loop not ended after 2 iterations", 2, 0},
+		{"MaxIterations over the cap", loop(`MaxIterations="4"`), RunOptions{MaxIterations: 2},
+			"", 4, 0},
+		{"no Timeout", `<Request Method="GET" Guid="g" Url="{{slow}}/slow" />`,
+			RunOptions{Timeout: 100 * time.Millisecond}, "", 1, 1},
+	}
+	for _, tt := range tests {
+		wt, err := Parse(strings.NewReader(string(webTestOf(tt.items))))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		tt.opt.Params = map[string]string{"web": srv.URL, "slow": slow.URL}
+		start := time.Now()
+		res, err := NewRunner(tt.opt).Run(ioutil.Discard, wt)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.err {
+			t.Errorf("%s: error %q, want %q", tt.name, got, tt.err)
+		}
+		if len(res.Requests) != tt.count || res.Failed != tt.failed {
+			t.Errorf("%s: %d requests, %d failed, want %d, %d", tt.name,
+				len(res.Requests), res.Failed, tt.count, tt.failed)
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Errorf("%s: took %v", tt.name, time.Since(start))
+		}
+	}
+}
@@ -0,0 +1,219 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-batch
+// Purpose: wts (web test script) multi-file inputs and parallel processing
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// stdinName is how the web test script read from stdin, -i -, is called
+const stdinName = webtest.StdinName
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// countWriter counts the bytes written through it
+type countWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// expandInputs turns the inputs, files, directories or globs, into the web
+// test scripts to process, in the given order and without duplicates. The
+// directories are searched recursively for the .webtest files. The "-" for
+// stdin can only be the single input
+func expandInputs(inputs []string) ([]string, error) {
+	for _, in := range inputs {
+		if in == "-" && len(inputs) > 1 {
+			return nil, fmt.Errorf("- (stdin) can only be the single input")
+		}
+	}
+	if len(inputs) == 1 && inputs[0] == "-" {
+		return inputs, nil
+	}
+	var scripts []string
+	seen := map[string]bool{}
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			scripts = append(scripts, s)
+		}
+	}
+	for _, in := range inputs {
+		matches := []string{in}
+		if strings.ContainsAny(in, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(in); err != nil {
+				return nil, fmt.Errorf("bad input pattern '%s': %v", in, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no web test script matches '%s'", in)
+			}
+		}
+		for _, m := range matches {
+			fi, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+			if !fi.IsDir() {
+				add(m)
+				continue
+			}
+			found, err := findScripts(m)
+			if err != nil {
+				return nil, err
+			}
+			if len(found) == 0 {
+				return nil, fmt.Errorf("no web test script in '%s'", m)
+			}
+			for _, s := range found {
+				add(s)
+			}
+		}
+	}
+	return scripts, nil
+}
+
+// findScripts lists the .webtest files under the dir, sorted
+func findScripts(dir string) ([]string, error) {
+	var found []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() && strings.EqualFold(filepath.Ext(path), ".webtest") {
+			found = append(found, path)
+		}
+		return nil
+	})
+	sort.Strings(found)
+	return found, err
+}
+
+// openInput opens the web test script, or takes stdin for "-", telling the
+// name to call it by
+func openInput(script string) (*os.File, string, error) {
+	if script == "-" {
+		return os.Stdin, stdinName, nil
+	}
+	f, err := os.Open(script)
+	return f, script, err
+}
+
+// createOutput creates the output file, or takes stdout for "-", which is
+// left open when closed
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// writeOutput writes the output file with write, or stdout for "-". The
+// file is written to a temp file next to it first, then renamed into
+// place, so that it is left as it was if write fails
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	// the temp file is only readable by the owner
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// replaceExt replaces the file extension of the path with ext, or adds ext
+// if there is none
+func replaceExt(path, ext string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
+
+// parallel calls work for 0 to n-1, with up to jobs of them at a time, or
+// as many as the CPUs if jobs is not given
+func parallel(n, jobs int, work func(i int)) {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for j := 0; j < jobs && j < n; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				work(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// batchError puts the errors of the scripts together. A single script
+// gets its error as is
+func batchError(scripts []string, errs []error) error {
+	if len(scripts) == 1 {
+		return errs[0]
+	}
+	var all webtest.ErrorList
+	for i, err := range errs {
+		if err != nil {
+			all = append(all, fmt.Errorf("%s: %v", scripts[i], err))
+		}
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	return all
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+// writeScripts writes the files, relative to a new temp dir returned
+func writeScripts(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "wts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := writeScripts(t, map[string]string{
+		"a.webtest": "", "b.webtest": "", "c.txt": "",
+		"sub/d.webtest": "", "sub/deep/e.WebTest": "", "empty/x.txt": "",
+	})
+	defer os.RemoveAll(dir)
+	in := func(names ...string) []string {
+		for i, n := range names {
+			if n != "-" {
+				names[i] = filepath.Join(dir, n)
+			}
+		}
+		return names
+	}
+
+	tests := []struct {
+		name   string
+		inputs []string
+		want   []string
+		err    string
+	}{
+		{"files in order", in("b.webtest", "a.webtest"), in("b.webtest", "a.webtest"), ""},
+		{"any file given", in("c.txt"), in("c.txt"), ""},
+		{"directory recursively", in("sub"),
+			in("sub/d.webtest", "sub/deep/e.WebTest"), ""},
+		{"glob", in("*.webtest"), in("a.webtest", "b.webtest"), ""},
+		{"no duplicates", in("a.webtest", "*.webtest", "."),
+			in("a.webtest", "b.webtest", "sub/d.webtest", "sub/deep/e.WebTest"), ""},
+		{"stdin", []string{"-"}, []string{"-"}, ""},
+		{"stdin not alone", in("a.webtest", "-"), nil, "can only be the single input"},
+		{"no match", in("*.none"), nil, "no web test script matches"},
+		{"no script in directory", in("empty"), nil, "no web test script in"},
+		{"not there", in("none.webtest"), nil, "no such file"},
+	}
+	for _, tt := range tests {
+		got, err := expandInputs(tt.inputs)
+		if len(tt.err) != 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParallel(t *testing.T) {
+	for _, jobs := range []int{0, 1, 3, 100} {
+		var running, most int32
+		done := make([]int32, 50)
+		parallel(len(done), jobs, func(i int) {
+			n := atomic.AddInt32(&running, 1)
+			for m := atomic.LoadInt32(&most); n > m; m = atomic.LoadInt32(&most) {
+				if atomic.CompareAndSwapInt32(&most, m, n) {
+					break
+				}
+			}
+			atomic.AddInt32(&done[i], 1)
+			atomic.AddInt32(&running, -1)
+		})
+		for i, d := range done {
+			if d != 1 {
+				t.Errorf("jobs %d: work %d done %d times", jobs, i, d)
+			}
+		}
+		if jobs > 0 && int(most) > jobs {
+			t.Errorf("jobs %d: %d at a time", jobs, most)
+		}
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	one := errors.New("bad")
+	if err := batchError([]string{"a"}, []error{one}); err != one {
+		t.Errorf("single script: %v", err)
+	}
+	if err := batchError([]string{"a", "b"}, []error{nil, nil}); err != nil {
+		t.Errorf("no errors: %v", err)
+	}
+	err := batchError([]string{"a", "b", "c"}, []error{one, nil, one})
+	if err == nil || err.Error() != "a: bad\nc: bad" {
+		t.Errorf("got %v", err)
+	}
+}
+
+// dumpText dumps the web test with the dump options
+func dumpText(t *testing.T, source string, opt webtest.DumpOptions) string {
+	dp, err := webtest.NewDumper("Sample.webtest", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := dp.Dump(&buf, strings.NewReader(source)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// TestBatchDump dumps many scripts at once, each next to its input, the
+// same as dumping them one by one
+func TestBatchDump(t *testing.T) {
+	files := map[string]string{}
+	for _, c := range "abcdefgh" {
+		name := string(c)
+		files[name+".webtest"] = `<WebTest Name="` + name + `"><Items>` +
+			`<Comment CommentText="[#1] ` + name + ` 2016-03-12" />` +
+			`<Request Method="GET" Guid="` + name + `" Url="{{web}}` + name +
+			`?t=3/12/2016" ThinkTime="0" Timeout="300" /></Items></WebTest>`
+	}
+	dir := writeScripts(t, files)
+	defer os.RemoveAll(dir)
+	scripts, err := expandInputs([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opt := Dump{Cnr: true, Tsr: true}
+	errs := make([]error, len(scripts))
+	parallel(len(scripts), 4, func(i int) {
+		errs[i] = dumpScript(scripts[i], opt)
+	})
+	if err := batchError(scripts, errs); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range scripts {
+		got, err := ioutil.ReadFile(replaceExt(s, ".webtext"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := dumpText(t, files[filepath.Base(s)], webtest.DumpOptions{Cnr: true, Tsr: true})
+		if string(got) != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", s, got, want)
+		}
+	}
+}
+
+// TestDumpOutputKept checks that a failed dump leaves the .webtext as it
+// was, and that no temp file is left behind
+func TestDumpOutputKept(t *testing.T) {
+	good := `<WebTest Name="a"><Items><Comment CommentText="c" /></Items></WebTest>`
+	bad := `<WebTest Name="a"><Items><Comment CommentText="&bad;" /></Items></WebTest>`
+	dir := writeScripts(t, map[string]string{"a.webtest": good, "a.webtext": "old"})
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "a.webtest")
+	output := replaceExt(script, ".webtext")
+
+	tests := []struct {
+		name   string
+		source string
+		opt    Dump
+		failed bool
+		want   string
+	}{
+		{"no .rawrule file", good, Dump{Raw: true, Rawrule: filepath.Join(dir, "none.rawrule")},
+			true, "old"},
+		{"malformed", bad, Dump{}, true, "old"},
+		{"dumped", good, Dump{}, false, "C: c\r\n"},
+		{"kept going", strings.Replace(bad, "</Items>", `<Comment CommentText="d" /></Items>`, 1),
+			Dump{KeepGoing: true}, true, "C: d\r\n"},
+	}
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(script, []byte(tt.source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := dumpScript(script, tt.opt)
+		if (err != nil) != tt.failed {
+			t.Errorf("%s: error %v", tt.name, err)
+		}
+		if got, _ := ioutil.ReadFile(output); !strings.Contains(string(got), tt.want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+		if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 2 {
+			t.Errorf("%s: files left %v", tt.name, files)
+		}
+	}
+}
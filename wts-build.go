@@ -0,0 +1,51 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-build
+// Purpose: wts (web test script) build verb, .webtext => .webtest
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+func buildCmd() error {
+	fileo := options.Build.Fileo
+	if fileo == nil {
+		var err error
+		fileo, err = os.Create(replaceExt(options.Build.Filei.Name(), ".webtest"))
+		if err != nil {
+			return err
+		}
+	}
+	defer fileo.Close()
+	defer options.Build.Filei.Close()
+
+	// named after its output file name
+	name := filepath.Base(fileo.Name())
+	opt := webtest.BuildOptions{Name: strings.TrimSuffix(name, filepath.Ext(name))}
+	if options.Build.Base != nil {
+		base, err := webtest.Parse(options.Build.Base)
+		options.Build.Base.Close()
+		if err != nil {
+			return fmt.Errorf("base web test: %v", err)
+		}
+		opt.Base = base
+	}
+	wt, err := webtest.Build(options.Build.Filei, opt)
+	if err != nil {
+		return fmt.Errorf("%s: %v", options.Build.Filei.Name(), err)
+	}
+	return wt.Encode(fileo)
+}
@@ -0,0 +1,126 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-check
+// Purpose: wts (web test script) check verb
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Constant and data type/structure definitions
+
+// FindingsError is returned by the check verb when there are findings at
+// or above the --fail-on severity, so as to exit with its own status
+type FindingsError struct {
+	Count int
+}
+
+func (e FindingsError) Error() string {
+	return fmt.Sprintf("%d finding(s)", e.Count)
+}
+
+// exitFindings is the exit status when check has findings
+const exitFindings = 3
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+func checkCmd() error {
+	opt := webtest.CheckOptions{ThinkTime: options.Check.ThinkTime,
+		Timeout: options.Check.Timeout, Checks: options.Check.Checks,
+		KeepGoing: options.Check.KeepGoing}
+	if options.Check.Rules != nil {
+		opt.Rules = options.Check.Rules.Name()
+		options.Check.Rules.Close()
+	}
+	checker, err := webtest.NewChecker(opt)
+	if err != nil {
+		return err
+	}
+	if !webtest.IsSeverity(options.Check.FailOn) &&
+		len(options.Check.FailOn) != 0 {
+		return fmt.Errorf("unknown severity '%s'", options.Check.FailOn)
+	}
+	scripts, err := expandInputs(options.Check.Filei)
+	if err != nil {
+		return err
+	}
+
+	// the findings are shown on stderr when the report goes to stdout
+	out := os.Stdout
+	if options.Check.Fileo == "-" {
+		out = os.Stderr
+	}
+
+	// each script is checked on its own, its findings shown in order after
+	outs := make([]bytes.Buffer, len(scripts))
+	checked := make([]*webtest.CheckResult, len(scripts))
+	errs := make([]error, len(scripts))
+	parallel(len(scripts), options.Check.Jobs, func(i int) {
+		checked[i], errs[i] = checkScript(checker, scripts[i], &outs[i])
+	})
+
+	var results []*webtest.CheckResult
+	var all []webtest.Finding
+	for i := range scripts {
+		out.Write(outs[i].Bytes())
+		// the findings before an error are reported as well
+		r := checked[i]
+		if r == nil {
+			continue
+		}
+		results = append(results, r)
+		all = append(all, r.Findings...)
+		if !options.Quiet {
+			fmt.Fprintf(out, "\r\n%s: %d request(s), %d dependent request(s), %s\r\n",
+				r.Script, r.Requests, r.DependentRequests,
+				webtest.CheckSummary(r.Findings))
+		}
+	}
+	if len(scripts) > 1 && !options.Quiet {
+		fmt.Fprintf(out, "\r\n%d of %d web test script(s) checked, %s\r\n",
+			len(results), len(scripts), webtest.CheckSummary(all))
+	}
+	if len(options.Check.Fileo) != 0 && len(results) != 0 {
+		fileo, err := createOutput(options.Check.Fileo)
+		if err != nil {
+			return err
+		}
+		defer fileo.Close()
+		format := options.Check.Format
+		if len(format) == 0 {
+			format = "json"
+		}
+		if err := webtest.WriteFindings(fileo, format, results); err != nil {
+			return err
+		}
+	}
+	if err := batchError(scripts, errs); err != nil {
+		return err
+	}
+	if n := webtest.CountFailing(all, options.Check.FailOn); n != 0 {
+		return FindingsError{n}
+	}
+	return nil
+}
+
+// checkScript lints the web test script, showing its findings to out
+func checkScript(checker *webtest.Checker, script string,
+	out *bytes.Buffer) (*webtest.CheckResult, error) {
+	filei, name, err := openInput(script)
+	if err != nil {
+		return nil, err
+	}
+	defer filei.Close()
+	return checker.Check(name, filei, out)
+}
@@ -0,0 +1,34 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-correlate
+// Purpose: wts (web test script) correlate verb
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"os"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+func correlateCmd() error {
+	defer options.Correlate.Filei.Close()
+	wt, err := webtest.Parse(options.Correlate.Filei)
+	if err != nil {
+		return err
+	}
+
+	rule := wt.Correlate(os.Stdout,
+		webtest.CorrelateOptions{Min: options.Correlate.Min})
+	if options.Correlate.Rawrule != nil {
+		defer options.Correlate.Rawrule.Close()
+		return rule.Encode(options.Correlate.Rawrule)
+	}
+	return nil
+}
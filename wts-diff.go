@@ -0,0 +1,32 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-diff
+// Purpose: wts (web test script) diff verb
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"os"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+func diffCmd() error {
+	defer options.Diff.Filea.Close()
+	defer options.Diff.Fileb.Close()
+	df, err := webtest.NewDiffer(options.Diff.Filea.Name(),
+		webtest.DiffOptions{Exact: options.Diff.Exact})
+	if err != nil {
+		return err
+	}
+	if !options.Diff.Exact && len(df.RawRule()) == 0 {
+		debug(options.Diff.Filea.Name()+": no .rawrule file, skip using it", 1)
+	}
+	return df.Diff(os.Stdout, options.Diff.Filea, options.Diff.Fileb)
+}
@@ -0,0 +1,56 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-fix
+// Purpose: wts (web test script) fix verb
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+func fixCmd() error {
+	script := options.Fix.Filei.Name()
+	source, err := ioutil.ReadAll(options.Fix.Filei)
+	options.Fix.Filei.Close()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if options.Quiet {
+		w = ioutil.Discard
+	}
+	fixed, n, err := webtest.Fix(w, source, webtest.FixOptions{
+		ThinkTime: options.Fix.ThinkTime, Timeout: options.Fix.Timeout})
+	if err != nil {
+		// the error tells the line:col, but not the file name
+		return fmt.Errorf("%s:%v", script, err)
+	}
+	if n == 0 {
+		if !options.Quiet {
+			fmt.Printf("%s: nothing to fix\n", script)
+		}
+		return nil
+	}
+
+	if options.Fix.DryRun {
+		webtest.FixDiff(os.Stdout, script, source, fixed)
+		return nil
+	}
+	if !options.Quiet {
+		fmt.Printf("%s: %d change(s)\n", script, n)
+	}
+	return ioutil.WriteFile(script, fixed, 0644)
+}
@@ -0,0 +1,110 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-fmt
+// Purpose: wts (web test script) fmt verb
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// fmtCmd rewrites the web test scripts canonically formatted, or with
+// --check, lists the ones that are not and fails if there are any
+func fmtCmd() error {
+	scripts, err := expandInputs(options.Fmt.Filei)
+	if err != nil {
+		return err
+	}
+	eol := "\r\n"
+	switch options.Fmt.Eol {
+	case "", "crlf":
+	case "lf":
+		eol = "\n"
+	default:
+		return fmt.Errorf("unknown line ending '%s'", options.Fmt.Eol)
+	}
+
+	errs := make([]error, len(scripts))
+	canonical := make([]bool, len(scripts))
+	parallel(len(scripts), options.Fmt.Jobs, func(i int) {
+		canonical[i], errs[i] = fmtScript(scripts[i], options.Fmt,
+			webtest.FormatOptions{Eol: eol, Guids: options.Fmt.Guids})
+	})
+	if err := batchError(scripts, errs); err != nil {
+		return err
+	}
+	if !options.Fmt.Check {
+		return nil
+	}
+
+	if failed := fmtUnformatted(os.Stdout, scripts, canonical); failed != 0 {
+		return fmt.Errorf("%d of %d web test script(s) not canonically formatted",
+			failed, len(scripts))
+	}
+	return nil
+}
+
+// fmtUnformatted lists the web test scripts not canonically formatted to
+// w, the one read from stdin by its stdinName, and tells how many
+func fmtUnformatted(w io.Writer, scripts []string, canonical []bool) int {
+	failed := 0
+	for i, script := range scripts {
+		if canonical[i] {
+			continue
+		}
+		if script == "-" {
+			script = stdinName
+		}
+		fmt.Fprintln(w, script)
+		failed++
+	}
+	return failed
+}
+
+// fmtScript formats the web test script in place, or to stdout for stdin,
+// unless with --check, and tells whether it is canonically formatted
+// already
+func fmtScript(script string, opt Fmt, fo webtest.FormatOptions) (bool, error) {
+	filei, name, err := openInput(script)
+	if err != nil {
+		return false, err
+	}
+	source, err := ioutil.ReadAll(filei)
+	filei.Close()
+	if err != nil {
+		return false, err
+	}
+	wt, err := webtest.Parse(bytes.NewReader(webtest.ToUtf8(source)))
+	if err != nil {
+		// the error tells the line:col, but not the file name
+		return false, fmt.Errorf("%s:%v", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := wt.Format(&buf, fo); err != nil {
+		return false, err
+	}
+	formatted := buf.Bytes()
+	canonical := bytes.Equal(source, formatted)
+	switch {
+	case opt.Check:
+	case script == "-":
+		_, err = os.Stdout.Write(formatted)
+	case !canonical:
+		err = ioutil.WriteFile(script, formatted, 0644)
+	}
+	return canonical, err
+}
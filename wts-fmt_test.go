@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+func TestFmtScript(t *testing.T) {
+	messy := `<WebTest Zeta="z" Name="T"><Items><Comment CommentText="c" /></Items></WebTest>`
+	dir := writeScripts(t, map[string]string{"a.webtest": messy})
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "a.webtest")
+	fo := webtest.FormatOptions{Eol: "\r\n"}
+
+	tests := []struct {
+		name      string
+		opt       Fmt
+		canonical bool
+		content   string
+	}{
+		{"check leaves it as is", Fmt{Check: true}, false, messy},
+		{"formatted in place", Fmt{}, false, ""},
+		{"canonical then", Fmt{Check: true}, true, ""},
+	}
+	for _, tt := range tests {
+		canonical, err := fmtScript(script, tt.opt, fo)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if canonical != tt.canonical {
+			t.Errorf("%s: canonical %v", tt.name, canonical)
+		}
+		got, _ := ioutil.ReadFile(script)
+		if len(tt.content) != 0 && string(got) != tt.content {
+			t.Errorf("%s: changed to\n%s", tt.name, got)
+		}
+		if len(tt.content) == 0 && !strings.Contains(string(got), `StopOnError="" ResultsLocale="" Zeta="z">`) {
+			t.Errorf("%s: not formatted\n%s", tt.name, got)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.webtest")
+	ioutil.WriteFile(bad, []byte("<WebTest>\n<Items>"), 0644)
+	if _, err := fmtScript(bad, Fmt{Check: true}, fo); err == nil ||
+		!strings.HasPrefix(err.Error(), bad+":2:8: ") {
+		t.Errorf("error %v, want at %s:2:8", err, bad)
+	}
+}
+
+func TestFmtUnformatted(t *testing.T) {
+	tests := []struct {
+		scripts   []string
+		canonical []bool
+		want      string
+	}{
+		{[]string{"a.webtest", "b.webtest", "c.webtest"}, []bool{false, true, false},
+			"a.webtest\nc.webtest\n"},
+		{[]string{"a.webtest"}, []bool{true}, ""},
+		{[]string{"-"}, []bool{false}, stdinName + "\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		failed := fmtUnformatted(&buf, tt.scripts, tt.canonical)
+		if buf.String() != tt.want || failed != strings.Count(tt.want, "\n") {
+			t.Errorf("%q: got %q (%d), want %q", tt.scripts, buf.String(), failed, tt.want)
+		}
+	}
+}
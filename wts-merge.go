@@ -0,0 +1,94 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-merge
+// Purpose: wts (web test script) git textconv and merge driver verbs
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+/*
+  To have git show the web test script changes as dumps, and merge them
+  request by request:
+
+  .gitattributes
+    *.webtest diff=webtest merge=webtest
+
+  .git/config
+    [diff "webtest"]
+      textconv = wts textconv
+    [merge "webtest"]
+      name = web test script merge
+      driver = wts merge %O %A %B
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// textconvCmd dumps the web test script to stdout, for git diff
+func textconvCmd() error {
+	args := options.Textconv.Remainder
+	if len(args) != 1 {
+		return fmt.Errorf("textconv takes a single web test script, %d given",
+			len(args))
+	}
+	return dumpScript(args[0], Dump{Fileo: "-", Raw: options.Textconv.Raw})
+}
+
+// mergeCmd merges the base (%O), ours (%A) and theirs (%B) web test
+// scripts into ours, for git merge. It fails when there are conflicts
+func mergeCmd() error {
+	args := options.Merge.Remainder
+	if len(args) != 3 {
+		return fmt.Errorf("merge takes the base, ours and theirs web test "+
+			"scripts, %d given", len(args))
+	}
+
+	var wts [3]*webtest.WebTest
+	var ours []byte
+	for i, script := range args {
+		source, err := ioutil.ReadFile(script)
+		if err != nil {
+			return err
+		}
+		source = webtest.ToUtf8(source)
+		// the base is empty when both sides added the script
+		if i == 0 && len(bytes.TrimSpace(source)) == 0 {
+			wts[i] = &webtest.WebTest{}
+			continue
+		}
+		if wts[i], err = webtest.Parse(bytes.NewReader(source)); err != nil {
+			return fmt.Errorf("%s:%v", script, err)
+		}
+		if i == 1 {
+			ours = source
+		}
+	}
+
+	var buf bytes.Buffer
+	conflicts, err := webtest.Merge(&buf, wts[0], wts[1], wts[2])
+	if err != nil {
+		return err
+	}
+	merged := buf.Bytes()
+	// keep the line endings of ours
+	if !bytes.Contains(ours, []byte("\r\n")) {
+		merged = bytes.Replace(merged, []byte("\r\n"), []byte("\n"), -1)
+	}
+	if err := ioutil.WriteFile(args[1], merged, 0644); err != nil {
+		return err
+	}
+	if conflicts != 0 {
+		return fmt.Errorf("%s: %d conflict(s)", args[1], conflicts)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-param
+// Purpose: wts (web test script) param verb
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+func paramCmd() error {
+	fileo := options.Param.Fileo
+	if fileo == nil {
+		var err error
+		fileo, err = os.Create(
+			replaceExt(options.Param.Filei.Name(), ".param.webtest"))
+		if err != nil {
+			return err
+		}
+	}
+	defer fileo.Close()
+
+	wt, err := webtest.Parse(options.Param.Filei)
+	options.Param.Filei.Close()
+	if err != nil {
+		return err
+	}
+
+	params := wt.ParamHosts(webtest.ParamOptions{Prefix: options.Param.Prefix})
+	if !options.Quiet {
+		for _, p := range params {
+			fmt.Printf("{{%s}} = %s\n", p.Name, p.Host)
+		}
+	}
+	return wt.Encode(fileo)
+}
@@ -0,0 +1,60 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-rawrule
+// Purpose: wts (web test script) rawrule verb
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// rawruleCmd validates the .rawrule file, and checks the examples of its
+// rules as the rawrule test verb
+func rawruleCmd() error {
+	filei, test := options.Rawrule.Filei, options.Rawrule.Verbs == "test"
+	if test {
+		filei = options.Rawrule.Test.Filei
+	}
+	if filei == nil {
+		return fmt.Errorf("no .rawrule file given, with -i")
+	}
+	filename := filei.Name()
+	filei.Close()
+
+	rawRule, err := webtest.LoadRawRule(filename)
+	if err != nil {
+		return err
+	}
+	if err := rawRule.Validate(); err != nil {
+		return err
+	}
+	if !options.Quiet {
+		fmt.Printf("%s: %d rule(s), %d extract, %d summarize\n", filename,
+			len(rawRule.Rules), len(rawRule.Extract), len(rawRule.Summarize))
+	}
+	if !test {
+		return nil
+	}
+
+	failed, total, err := rawRule.Test(os.Stdout)
+	if err != nil {
+		return err
+	}
+	if !options.Quiet {
+		fmt.Printf("%d example(s), %d failed\n", total, failed)
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d example(s) failed", failed, total)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+////////////////////////////////////////////////////////////////////////////
+// Porgram: wts-run
+// Purpose: wts (web test script) run verb
+// authors: Antonio Sun (c) 2016, All rights reserved
+////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+import (
+	"github.com/AntonioSun/wts/webtest"
+)
+
+////////////////////////////////////////////////////////////////////////////
+// Function definitions
+
+// runCmd runs the web test scripts one after another, and fails if any
+// of their requests does
+func runCmd() error {
+	scripts, err := expandInputs(options.Run.Filei)
+	if err != nil {
+		return err
+	}
+	params := map[string]string{}
+	for _, p := range options.Run.Params {
+		i := strings.Index(p, "=")
+		if i <= 0 {
+			return fmt.Errorf("bad context parameter '%s', name=value expected", p)
+		}
+		params[p[:i]] = p[i+1:]
+	}
+
+	total, failed := 0, 0
+	errs := make([]error, len(scripts))
+	for i, script := range scripts {
+		var r *webtest.RunResult
+		r, errs[i] = runScript(script, webtest.RunOptions{Params: params,
+			NoThinkTime: options.Run.NoThinkTime, Dir: filepath.Dir(script),
+			MaxIterations: options.Run.MaxIterations,
+			Timeout:       time.Duration(options.Run.Timeout) * time.Second})
+		if r == nil {
+			continue
+		}
+		total += len(r.Requests)
+		failed += r.Failed
+		if script == "-" {
+			script = stdinName
+		}
+		if !options.Quiet {
+			fmt.Printf("%s: %d of %d request(s) passed\r\n", script,
+				len(r.Requests)-r.Failed, len(r.Requests))
+		}
+	}
+	if len(scripts) > 1 && !options.Quiet {
+		fmt.Printf("\r\n%d web test script(s) run, %d of %d request(s) passed\r\n",
+			len(scripts), total-failed, total)
+	}
+	if err := batchError(scripts, errs); err != nil {
+		return err
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d request(s) failed", failed)
+	}
+	return nil
+}
+
+// runScript runs the web test script, showing the outcome of its requests
+func runScript(script string, opt webtest.RunOptions) (*webtest.RunResult, error) {
+	filei, name, err := openInput(script)
+	if err != nil {
+		return nil, err
+	}
+	wt, err := webtest.Parse(filei)
+	filei.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", name, err)
+	}
+	return webtest.NewRunner(opt).Run(os.Stdout, wt)
+}